@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/zip"
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"chirpy/internal/passwords"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (cfg *apiConfig) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := db.GetUser(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// A stolen access token isn't enough to delete an account, the password is asked again
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	ok, err := passwords.Verify(user.Password, params.Password)
+	if err != nil || !ok {
+		respondWithError(w, http.StatusUnauthorized, "Wrong password")
+		return
+	}
+	cfg.passLogin(r, user.Email)
+
+	deleted, err := db.DeleteUser(id, cfg.deletedChirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user")
+		return
+	}
+	for _, chirp := range deleted {
+		if chirp.DeletedAt == nil && chirp.Status == Database.ChirpPublished {
+			cfg.publishChirp(events.ChirpDeleted, chirp)
+		}
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+func exportUserHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	data, err := db.GetUserData(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	type profile struct {
+		Id                      int             `json:"id"`
+		Email                   string          `json:"email"`
+		Verified                bool            `json:"verified"`
+		IsChirpyRed             bool            `json:"is_chirpy_red"`
+		Handle                  string          `json:"handle"`
+		DisplayName             string          `json:"display_name"`
+		Bio                     string          `json:"bio"`
+		AvatarURL               string          `json:"avatar_url"`
+		TwoFactorEnabled        bool            `json:"two_factor_enabled"`
+		NotificationPreferences map[string]bool `json:"notification_preferences"`
+	}
+	type chirp struct {
+		Id         int        `json:"id"`
+		Body       string     `json:"body"`
+		CreatedAt  time.Time  `json:"created_at"`
+		DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+		Status     string     `json:"status"`
+		Visibility string     `json:"visibility"`
+		ReplyToId  int        `json:"reply_to_id,omitempty"`
+	}
+	type like struct {
+		ChirpId   int       `json:"chirp_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type follow struct {
+		UserId    int       `json:"user_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type relation struct {
+		UserId    int       `json:"user_id"`
+		Kind      string    `json:"kind"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type notification struct {
+		Type      string     `json:"type"`
+		Message   string     `json:"message"`
+		ChirpId   int        `json:"chirp_id,omitempty"`
+		CreatedAt time.Time  `json:"created_at"`
+		ReadAt    *time.Time `json:"read_at,omitempty"`
+	}
+	type report struct {
+		ChirpId   int       `json:"chirp_id,omitempty"`
+		UserId    int       `json:"user_id,omitempty"`
+		Category  string    `json:"category"`
+		Text      string    `json:"text"`
+		Status    string    `json:"status"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// Chirps are exported as written, without the profanity mask
+	user := data.User
+	files := map[string]interface{}{
+		"profile.json": profile{Id: user.Id, Email: user.Email, Verified: user.Verified, IsChirpyRed: user.IsChirpyRed, Handle: user.Handle, DisplayName: user.DisplayName, Bio: user.Bio, AvatarURL: user.AvatarURL, TwoFactorEnabled: user.TOTPEnabled, NotificationPreferences: user.NotificationPreferences},
+	}
+	chirps := []chirp{}
+	for _, c := range data.Chirps {
+		chirps = append(chirps, chirp{Id: c.Id, Body: c.Body, CreatedAt: c.CreatedAt, DeletedAt: c.DeletedAt, Status: c.Status, Visibility: c.Visibility, ReplyToId: c.ReplyToId})
+	}
+	files["chirps.json"] = chirps
+	likes := []like{}
+	for _, l := range data.Likes {
+		likes = append(likes, like{ChirpId: l.ChirpId, CreatedAt: l.CreatedAt})
+	}
+	files["likes.json"] = likes
+	following := []follow{}
+	for _, f := range data.Following {
+		following = append(following, follow{UserId: f.FolloweeId, CreatedAt: f.CreatedAt})
+	}
+	files["following.json"] = following
+	followers := []follow{}
+	for _, f := range data.Followers {
+		followers = append(followers, follow{UserId: f.FollowerId, CreatedAt: f.CreatedAt})
+	}
+	files["followers.json"] = followers
+	relations := []relation{}
+	for _, rel := range data.Relations {
+		relations = append(relations, relation{UserId: rel.TargetId, Kind: rel.Kind, CreatedAt: rel.CreatedAt})
+	}
+	files["blocks_and_mutes.json"] = relations
+	notifications := []notification{}
+	for _, n := range data.Notifications {
+		notifications = append(notifications, notification{Type: n.Type, Message: n.Message, ChirpId: n.ChirpId, CreatedAt: n.CreatedAt, ReadAt: n.ReadAt})
+	}
+	files["notifications.json"] = notifications
+	reports := []report{}
+	for _, rep := range data.Reports {
+		reports = append(reports, report{ChirpId: rep.ChirpId, UserId: rep.UserId, Category: rep.Category, Text: rep.Text, Status: rep.Status, CreatedAt: rep.CreatedAt})
+	}
+	files["reports.json"] = reports
+
+	// Everything is encoded before the first byte is written, so errors can still be reported
+	encoded := make(map[string][]byte, len(files))
+	for name, content := range files {
+		dat, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't export data")
+			return
+		}
+		encoded[name] = dat
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%d.zip"`, user.Id))
+	w.WriteHeader(http.StatusOK)
+	archive := zip.NewWriter(w)
+	for _, name := range []string{"profile.json", "chirps.json", "likes.json", "following.json", "followers.json", "blocks_and_mutes.json", "notifications.json", "reports.json"} {
+		file, err := archive.Create(name)
+		if err != nil {
+			return
+		}
+		file.Write(encoded[name])
+	}
+	archive.Close()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/moderation"
+)
+
+// moderateChirp runs a new chirp through the moderation pipeline and returns the chirp
+// to store, with its status and the decisions of the rules that matched
+func (cfg *apiConfig) moderateChirp(db *Database.DB, authorId int, body string) (Database.Chirp, moderation.Result, error) {
+	chirp := Database.Chirp{AuthorId: authorId}
+
+	// Held chirps count too, or a chirp waiting for review could be posted again right away
+	recentChirps, err := db.GetChirpsForModeration(authorId)
+	if err != nil {
+		return chirp, moderation.Result{}, err
+	}
+	post := moderation.Post{AuthorId: authorId, Body: body}
+	for _, recent := range recentChirps {
+		post.Recent = append(post.Recent, moderation.RecentPost{Body: recent.Body, CreatedAt: recent.CreatedAt})
+	}
+
+	result := cfg.moderation.Run(post)
+	chirp.Body = result.Body
+	chirp.Status = Database.ChirpPublished
+	if result.Action == moderation.Hold {
+		chirp.Status = Database.ChirpHeld
+	}
+	for _, decision := range result.Decisions {
+		chirp.Moderation = append(chirp.Moderation, Database.ModerationDecision{
+			Rule:   decision.Rule,
+			Action: decision.Action.String(),
+			Reason: decision.Reason,
+		})
+	}
+	return chirp, result, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxChirpLength = 140
+	urlChirpWeight = 23
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s]+`)
+
+// chirpLength counts the visible characters of a chirp, every URL weighs urlChirpWeight
+func chirpLength(body string) int {
+	length := 0
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		length += uniseg.GraphemeClusterCount(body[last:loc[0]]) + urlChirpWeight
+		last = loc[1]
+	}
+	return length + uniseg.GraphemeClusterCount(body[last:])
+}
+
+// validateChirpBody normalizes a chirp body to NFC and checks it against the chirp rules
+func validateChirpBody(body string) (string, []validationError) {
+	var violations []validationError
+	body = norm.NFC.String(body)
+
+	if strings.TrimSpace(body) == "" {
+		violations = append(violations, validationError{Rule: "not_empty", Message: "Chirp can't be empty"})
+	}
+	for _, char := range body {
+		if unicode.IsControl(char) && char != '\n' {
+			violations = append(violations, validationError{Rule: "no_control_characters", Message: fmt.Sprintf("Chirp contains the control character %U", char)})
+			break
+		}
+	}
+	if length := chirpLength(body); length > maxChirpLength {
+		violations = append(violations, validationError{Rule: "max_length", Message: fmt.Sprintf("Chirp is %d characters long, the maximum is %d", length, maxChirpLength)})
+	}
+	return body, violations
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"chirpy/internal/moderation"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"sort"
 	"strconv"
@@ -19,12 +22,17 @@ func addChirpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type parameters struct {
-		Body string `json:"body"`
+		Body       string `json:"body"`
+		Visibility string `json:"visibility"`
+		ReplyToId  int    `json:"reply_to_id"`
 	}
 	type returnVals struct {
-		AuthorId int    `json:"author_id"`
-		Id       int    `json:"id"`
-		Body     string `json:"body"`
+		AuthorId   int    `json:"author_id"`
+		Id         int    `json:"id"`
+		Body       string `json:"body"`
+		Status     string `json:"status"`
+		Visibility string `json:"visibility"`
+		ReplyToId  int    `json:"reply_to_id,omitempty"`
 	}
 
 	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
@@ -35,6 +43,18 @@ func addChirpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ApiConfig.requireVerified {
+		author, err := db.GetUser(id)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+			return
+		}
+		if !author.Verified {
+			respondWithError(w, http.StatusForbidden, "Verify your email before posting")
+			return
+		}
+	}
+
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err = decoder.Decode(&params)
@@ -43,17 +63,110 @@ func addChirpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(params.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "Chirp too long")
+	body, violations := validateChirpBody(params.Body)
+	if params.Visibility == "" {
+		params.Visibility = Database.VisibilityPublic
+	}
+	if params.Visibility != Database.VisibilityPublic && params.Visibility != Database.VisibilityFollowers && params.Visibility != Database.VisibilityMentioned {
+		violations = append(violations, validationError{Rule: "visibility", Message: "Visibility must be public, followers or mentioned"})
+	}
+	if len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid chirp", violations)
+		return
+	}
+
+	var parent Database.Chirp
+	if params.ReplyToId != 0 {
+		parent, err = db.GetChirp(id, params.ReplyToId)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp to reply to not found")
+			return
+		}
+		blocked, err := db.IsBlockedBy(parent.AuthorId, id)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp")
+			return
+		}
+		if blocked {
+			respondWithError(w, http.StatusForbidden, "You can't reply to this chirp")
+			return
+		}
+	}
+
+	mentions, blockedBy, err := extractMentions(db, id, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve mentions")
+		return
+	}
+	if len(blockedBy) > 0 {
+		respondWithError(w, http.StatusForbidden, "You can't mention @"+strings.Join(blockedBy, ", @"))
+		return
+	}
+
+	chirp, result, err := ApiConfig.moderateChirp(db, id, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't moderate chirp")
+		return
+	}
+	if result.Action == moderation.Reject {
+		violations := []validationError{}
+		for _, decision := range result.Decisions {
+			if decision.Action == moderation.Reject {
+				violations = append(violations, validationError{Rule: decision.Rule, Message: decision.Reason})
+			}
+		}
+		respondWithValidationErrors(w, "Chirp rejected by moderation", violations)
+		return
+	}
+
+	chirp.Visibility = params.Visibility
+	chirp.Mentions = mentions
+	chirp.ReplyToId = params.ReplyToId
+	chirp, err = db.CreateChirp(chirp)
+	if errors.Is(err, Database.ErrUserNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	var chirp Database.Chirp
-	chirp, err = db.CreateChirp(params.Body, id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, returnVals{AuthorId: chirp.AuthorId, Body: badWordConvertor(chirp.Body), Id: chirp.Id})
+	code := http.StatusCreated
+	if chirp.Status == Database.ChirpHeld {
+		var reasons []string
+		for _, decision := range chirp.Moderation {
+			if decision.Action == moderation.Hold.String() {
+				reasons = append(reasons, decision.Rule+": "+decision.Reason)
+			}
+		}
+		_, err = db.CreateModerationItem(chirp.Id, 0, "moderation", strings.Join(reasons, "; "))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't queue chirp for review")
+			return
+		}
+		code = http.StatusAccepted
+	} else {
+		ApiConfig.publishChirp(events.ChirpCreated, chirp)
+		if chirp.ReplyToId != 0 {
+			notify(db, Database.Notification{
+				UserId:  parent.AuthorId,
+				ActorId: id,
+				Type:    Database.NotificationReply,
+				ChirpId: chirp.Id,
+				Message: actorName(db, id) + " replied to your chirp",
+			})
+		}
+		for _, mentioned := range chirp.Mentions {
+			notify(db, Database.Notification{
+				UserId:  mentioned,
+				ActorId: id,
+				Type:    Database.NotificationMention,
+				ChirpId: chirp.Id,
+				Message: actorName(db, id) + " mentioned you",
+			})
+		}
+	}
+	respondWithJSON(w, code, returnVals{AuthorId: chirp.AuthorId, Body: ApiConfig.profanityFilter.Mask(chirp.Body), Id: chirp.Id, Status: chirp.Status, Visibility: chirp.Visibility, ReplyToId: chirp.ReplyToId})
 }
 
 func getChirpsHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,10 +180,17 @@ func getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	stringAuthorId := r.URL.Query().Get("author_id")
 	sortMethod := r.URL.Query().Get("sort")
 
+	viewerId, errorCode := optionalAccessToken(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
 	type returnVals []struct {
-		Body     string `json:"body"`
-		Id       int    `json:"id"`
-		AuthorId int    `json:"author_id"`
+		Body       string `json:"body"`
+		Id         int    `json:"id"`
+		AuthorId   int    `json:"author_id"`
+		Visibility string `json:"visibility"`
 	}
 
 	if stringAuthorId != "" {
@@ -79,15 +199,22 @@ func getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 			return
 		}
-		chirps, err = db.GetChirps(&authorId)
+		chirps, err = db.GetChirps(viewerId, &authorId)
 	} else {
-		chirps, err = db.GetChirps(nil)
+		chirps, err = db.GetChirps(viewerId, nil)
 	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
 	}
 
+	// Muted authors only drop out of the feed, asking for their chirps by author still works
+	excluded, err := db.GetExcludedAuthors(viewerId, stringAuthorId == "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
 	if sortMethod != "" && sortMethod == "desc" {
 		sort.Slice(chirps, func(i, j int) bool {
 			return chirps[i].Id > chirps[j].Id
@@ -100,14 +227,19 @@ func getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 
 	var response = returnVals{}
 	for _, chirp := range chirps {
+		if excluded[chirp.AuthorId] {
+			continue
+		}
 		response = append(response, struct {
-			Body     string `json:"body"`
-			Id       int    `json:"id"`
-			AuthorId int    `json:"author_id"`
+			Body       string `json:"body"`
+			Id         int    `json:"id"`
+			AuthorId   int    `json:"author_id"`
+			Visibility string `json:"visibility"`
 		}{
-			Body:     chirp.Body,
-			Id:       chirp.Id,
-			AuthorId: chirp.AuthorId,
+			Body:       ApiConfig.profanityFilter.Mask(chirp.Body),
+			Id:         chirp.Id,
+			AuthorId:   chirp.AuthorId,
+			Visibility: chirp.Visibility,
 		})
 	}
 	respondWithJSON(w, http.StatusOK, response)
@@ -121,8 +253,9 @@ func getChirpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type returnVals struct {
-		Body string `json:"body"`
-		Id   int    `json:"id"`
+		Body       string `json:"body"`
+		Id         int    `json:"id"`
+		Visibility string `json:"visibility"`
 	}
 	stringId := chi.URLParam(r, "chirpID")
 	if err != nil || stringId == "" {
@@ -136,14 +269,30 @@ func getChirpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirp, err := db.GetChirp(id)
+	viewerId, errorCode := optionalAccessToken(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	// Chirps the viewer isn't allowed to see are reported as missing so their existence doesn't leak
+	chirp, err := db.GetChirp(viewerId, id)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Chirp not found")
 		return
 
 	}
+	blocked, err := db.IsBlockedBy(viewerId, chirp.AuthorId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp")
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, returnVals{Body: chirp.Body, Id: chirp.Id})
+	respondWithJSON(w, http.StatusOK, returnVals{Body: ApiConfig.profanityFilter.Mask(chirp.Body), Id: chirp.Id, Visibility: chirp.Visibility})
 }
 
 func deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
@@ -169,24 +318,14 @@ func deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
 	userId, errorCode := verifyToken("chirpy-access", stringToken)
 	if errorCode != 0 {
 		respondWithError(w, errorCode, "Unauthorized")
+		return
 	}
 
-	err = db.DeleteChirp(chirpId, userId)
+	chirp, err := db.DeleteChirp(chirpId, userId)
 	if err != nil {
 		respondWithError(w, http.StatusForbidden, "You can't delete this chirp")
+		return
 	}
+	ApiConfig.publishChirp(events.ChirpDeleted, chirp)
 	respondWithoutJSON(w, http.StatusOK)
 }
-
-func badWordConvertor(message string) string {
-	badWords := []string{"kerfuffle", "sharbert", "fornax"}
-	words := strings.Fields(message)
-	for i, word := range words {
-		for _, badWord := range badWords {
-			if strings.ToLower(word) == badWord {
-				words[i] = "****"
-			}
-		}
-	}
-	return strings.Join(words, " ")
-}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// createAdminCommand runs "chirpy create-admin", which makes the first admin. An existing
+// account with the email is promoted, otherwise one is created with the given password.
+// It returns the exit code
+func createAdminCommand(args []string) int {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the admin")
+	password := flags.String("password", "", "password for a new account, defaults to $ADMIN_PASSWORD")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *password == "" {
+		*password = os.Getenv("ADMIN_PASSWORD")
+	}
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "Usage: chirpy create-admin -email <email> [-password <password>]")
+		return 2
+	}
+
+	db, err := Database.NewDB("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't open database: %s\n", err)
+		return 1
+	}
+
+	user, err := db.GetUserByEmail(*email)
+	if errors.Is(err, Database.ErrUserNotFound) {
+		violations := validateEmail(*email)
+		violations = append(violations, ApiConfig.validatePassword(*password, *email)...)
+		if len(violations) > 0 {
+			for _, violation := range violations {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", violation.Rule, violation.Message)
+			}
+			return 1
+		}
+		user, err = db.CreateUser(*email, *password)
+		if err == nil {
+			// The operator typed the address, there is nobody to send a verification link to
+			user, err = db.VerifyUser(user.Id, user.Email)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create admin: %s\n", err)
+		return 1
+	}
+
+	user, err = db.SetRole(user.Id, Database.RoleAdmin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create admin: %s\n", err)
+		return 1
+	}
+	fmt.Printf("User %d (%s) is now %s\n", user.Id, user.Email, user.Role)
+	return 0
+}
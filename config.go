@@ -1,21 +1,74 @@
 package main
 
 import (
+	"chirpy/internal/events"
+	"chirpy/internal/mailer"
+	"chirpy/internal/moderation"
+	"chirpy/internal/passwords"
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 )
 
 type apiConfig struct {
-	fileserverHits int
-	jwtScret       string
-	polkaApiKey    string
+	fileserverHits  int
+	jwtScret        string
+	polkaApiKey     string
+	trashRetention  time.Duration
+	profanityFilter *moderation.Filter
+	moderation      *moderation.Pipeline
+	adminApiKey     string
+	reportThreshold int
+	events          *events.Bus
+
+	mailer                     mailer.Mailer
+	publicURL                  string
+	requireVerified            bool
+	verificationResendInterval time.Duration
+
+	accountThrottle *loginThrottle
+	ipThrottle      *loginThrottle
+	passwordPolicy  passwords.Policy
+	// dummyPasswordHash is verified against when an email is unknown, so those logins take as long as wrong passwords
+	dummyPasswordHash string
+	// deletedChirps is what happens to the chirps of deleted accounts, Database.DeletedChirpsDelete or DeletedChirpsReassign
+	deletedChirps string
 }
 
 func setUpApiConfig(serverHits int, secretKey, polkaApiKey string) *apiConfig {
 	return &apiConfig{fileserverHits: serverHits, jwtScret: secretKey, polkaApiKey: polkaApiKey}
 }
 
+// getEnvInt reads an integer from the environment, falling back when it is unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// newMailer picks the mailer named by MAILER: smtp, file or, by default, log
+func newMailer() mailer.Mailer {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return mailer.SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	case "file":
+		return &mailer.FileMailer{Path: os.Getenv("MAIL_FILE")}
+	default:
+		return mailer.LogMailer{}
+	}
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	if code > 499 {
 		log.Printf("Responding with 5XX error: %s", msg)
@@ -28,6 +81,22 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	})
 }
 
+type validationError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, msg string, violations []validationError) {
+	type errorResponse struct {
+		Error      string            `json:"error"`
+		Violations []validationError `json:"violations"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:      msg,
+		Violations: violations,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
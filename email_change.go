@@ -0,0 +1,73 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/mailer"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// sendEmailChange mails a confirmation link to newEmail and warns the current address about the change
+func (cfg *apiConfig) sendEmailChange(user Database.User, newEmail string) error {
+	token, err := createEmailToken(user.Id, newEmail, verificationExpirySeconds, "chirpy-email-change")
+	if err != nil {
+		return err
+	}
+	link := cfg.publicURL + "/api/users/email/confirm?token=" + url.QueryEscape(token)
+	err = cfg.mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email",
+		Body:    fmt.Sprintf("Open this link within 24 hours to use this address for your Chirpy account:\n%s", link),
+	})
+	if err != nil {
+		return err
+	}
+	// The warning is best effort, the old address may well be the reason for the change
+	err = cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email is being changed",
+		Body:    fmt.Sprintf("Someone asked to change the email of your Chirpy account to %s.\n\nIt only changes once confirmed from that address. If it wasn't you, reset your password now.", newEmail),
+	})
+	if err != nil {
+		log.Printf("Couldn't warn the old address of user %d: %s", user.Id, err)
+	}
+	return nil
+}
+
+func confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		Id       int    `json:"id"`
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+	}
+
+	id, email, err := verifyEmailToken("chirpy-email-change", r.URL.Query().Get("token"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired confirmation link")
+		return
+	}
+
+	user, err := db.ConfirmEmailChange(id, email)
+	if errors.Is(err, Database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email already taken")
+		return
+	}
+	if errors.Is(err, Database.ErrEmailChanged) || errors.Is(err, Database.ErrUserNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired confirmation link")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't change email")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Email: user.Email, Verified: user.Verified})
+}
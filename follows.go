@@ -0,0 +1,230 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultTimelineLimit = 20
+	maxTimelineLimit     = 100
+)
+
+func followUserHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	followerId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	followeeId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	if followeeId == followerId {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+		return
+	}
+	if _, err := db.GetUser(followeeId); err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	_, err = db.FollowUser(followerId, followeeId)
+	if errors.Is(err, Database.ErrAlreadyFollowing) {
+		respondWithError(w, http.StatusConflict, "You already follow this user")
+		return
+	}
+	if errors.Is(err, Database.ErrBlocked) {
+		respondWithError(w, http.StatusForbidden, "You can't follow this user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user")
+		return
+	}
+
+	notify(db, Database.Notification{
+		UserId:  followeeId,
+		ActorId: followerId,
+		Type:    Database.NotificationFollow,
+		Message: actorName(db, followerId) + " started following you",
+	})
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+func unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	followerId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	followeeId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	err = db.UnfollowUser(followerId, followeeId)
+	if errors.Is(err, Database.ErrNotFollowing) {
+		respondWithError(w, http.StatusNotFound, "You don't follow this user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+func getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, func(db *Database.DB, userId int) ([]Database.Follow, error) {
+		return db.GetFollowers(userId)
+	}, func(follow Database.Follow) int {
+		return follow.FollowerId
+	})
+}
+
+func getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, func(db *Database.DB, userId int) ([]Database.Follow, error) {
+		return db.GetFollowing(userId)
+	}, func(follow Database.Follow) int {
+		return follow.FolloweeId
+	})
+}
+
+// listFollows responds with one side of the follows of the user in the url, get loads the
+// follows and other picks the user on the other end of each of them
+func listFollows(w http.ResponseWriter, r *http.Request, get func(*Database.DB, int) ([]Database.Follow, error), other func(Database.Follow) int) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type followedUser struct {
+		Id         int       `json:"id"`
+		Handle     string    `json:"handle"`
+		FollowedAt time.Time `json:"followed_at"`
+	}
+	type returnVals struct {
+		Count int            `json:"count"`
+		Users []followedUser `json:"users"`
+	}
+
+	userId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	if _, err := db.GetUser(userId); err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	follows, err := get(db, userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follows")
+		return
+	}
+
+	response := returnVals{Count: len(follows), Users: []followedUser{}}
+	for _, follow := range follows {
+		user, err := db.GetUser(other(follow))
+		if err != nil {
+			continue
+		}
+		response.Users = append(response.Users, followedUser{Id: user.Id, Handle: user.Handle, FollowedAt: follow.CreatedAt})
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func getTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type timelineChirp struct {
+		Body       string    `json:"body"`
+		Id         int       `json:"id"`
+		AuthorId   int       `json:"author_id"`
+		Visibility string    `json:"visibility"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	type returnVals struct {
+		Chirps     []timelineChirp `json:"chirps"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	before := 0
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		before, err = strconv.Atoi(cursor)
+		if err != nil || before <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	limit := defaultTimelineLimit
+	if stringLimit := r.URL.Query().Get("limit"); stringLimit != "" {
+		limit, err = strconv.Atoi(stringLimit)
+		if err != nil || limit <= 0 || limit > maxTimelineLimit {
+			respondWithError(w, http.StatusBadRequest, "Limit must be between 1 and "+strconv.Itoa(maxTimelineLimit))
+			return
+		}
+	}
+
+	chirps, err := db.GetTimeline(userId, before, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve timeline")
+		return
+	}
+
+	response := returnVals{Chirps: []timelineChirp{}}
+	for _, chirp := range chirps {
+		response.Chirps = append(response.Chirps, timelineChirp{
+			Body:       ApiConfig.profanityFilter.Mask(chirp.Body),
+			Id:         chirp.Id,
+			AuthorId:   chirp.AuthorId,
+			Visibility: chirp.Visibility,
+			CreatedAt:  chirp.CreatedAt,
+		})
+	}
+	if len(chirps) == limit {
+		response.NextCursor = strconv.Itoa(chirps[len(chirps)-1].Id)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -7,6 +7,14 @@ require github.com/go-chi/chi/v5 v5.0.10
 require golang.org/x/crypto v0.14.0
 
 require (
-	github.com/golang-jwt/jwt/v5 v5.0.0 
+	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/joho/godotenv v1.5.1
 )
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/rivo/uniseg v0.4.4
+	golang.org/x/text v0.13.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
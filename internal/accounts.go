@@ -0,0 +1,213 @@
+package Database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What happens to the chirps of a deleted account
+const (
+	DeletedChirpsDelete   = "delete"
+	DeletedChirpsReassign = "reassign"
+)
+
+// UserData is everything stored about a user, for exports
+type UserData struct {
+	User          User
+	Chirps        []Chirp
+	Likes         []Like
+	Following     []Follow
+	Followers     []Follow
+	Relations     []Relation
+	Notifications []Notification
+	Reports       []Report
+}
+
+// GetUserData collects every record that belongs to a user, trashed and held chirps included
+func (db *DB) GetUserData(id int) (UserData, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return UserData{}, err
+	}
+	data := UserData{}
+	found := false
+	for _, user := range dbStructure.Users {
+		if user.Id == id && !user.Deleted {
+			data.User = user
+			found = true
+		}
+	}
+	if !found {
+		return UserData{}, ErrUserNotFound
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorId == id {
+			data.Chirps = append(data.Chirps, chirp)
+		}
+	}
+	for _, like := range dbStructure.Likes {
+		if like.UserId == id {
+			data.Likes = append(data.Likes, like)
+		}
+	}
+	for _, follow := range dbStructure.Follows {
+		if follow.FollowerId == id {
+			data.Following = append(data.Following, follow)
+		}
+		if follow.FolloweeId == id {
+			data.Followers = append(data.Followers, follow)
+		}
+	}
+	for _, relation := range dbStructure.Relations {
+		if relation.UserId == id {
+			data.Relations = append(data.Relations, relation)
+		}
+	}
+	for _, notification := range dbStructure.Notifications {
+		if notification.UserId == id {
+			data.Notifications = append(data.Notifications, notification)
+		}
+	}
+	for _, report := range dbStructure.Reports {
+		if report.ReporterId == id {
+			data.Reports = append(data.Reports, report)
+		}
+	}
+	return data, nil
+}
+
+// DeleteUser removes a user and everything tied to them. Their chirps are deleted or, with
+// DeletedChirpsReassign, moved to the anonymous account. Only an empty record stays behind so
+// the id is never handed out again. It returns the chirps that were deleted
+func (db *DB) DeleteUser(id int, chirpMode string) ([]Chirp, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	userKey := -1
+	for key, user := range dbStructure.Users {
+		if user.Id == id && !user.Anonymous && !user.Deleted {
+			userKey = key
+		}
+	}
+	if userKey == -1 {
+		return nil, ErrUserNotFound
+	}
+
+	var deleted []Chirp
+	deletedIds := make(map[int]bool)
+	if chirpMode == DeletedChirpsReassign {
+		anonymousId := dbStructure.anonymousUser()
+		index := dbStructure.chirpIndex()
+		for key, chirp := range dbStructure.Chirps {
+			if chirp.AuthorId == id {
+				chirp.AuthorId = anonymousId
+				dbStructure.Chirps[key] = chirp
+				index[anonymousId] = append(index[anonymousId], chirp.Id)
+			}
+		}
+		// The index is kept sorted by id, reassigned chirps are interleaved with earlier ones
+		sort.Ints(index[anonymousId])
+		delete(index, id)
+	} else {
+		for key, chirp := range dbStructure.Chirps {
+			if chirp.AuthorId == id {
+				deleted = append(deleted, chirp)
+				deletedIds[chirp.Id] = true
+				delete(dbStructure.Chirps, key)
+			}
+		}
+		delete(dbStructure.chirpIndex(), id)
+		for key, like := range dbStructure.Likes {
+			if deletedIds[like.ChirpId] {
+				delete(dbStructure.Likes, key)
+			}
+		}
+	}
+
+	// The name notify gave the user in messages, before the record is emptied
+	actorName := fmt.Sprintf("User %d", id)
+	if handle := dbStructure.Users[userKey].Handle; handle != "" {
+		actorName = "@" + handle
+	}
+	dbStructure.Users[userKey] = User{Id: id, Deleted: true, TokensValidAfter: time.Now()}
+	for key, like := range dbStructure.Likes {
+		if like.UserId == id {
+			delete(dbStructure.Likes, key)
+		}
+	}
+	for key, follow := range dbStructure.Follows {
+		if follow.FollowerId == id || follow.FolloweeId == id {
+			delete(dbStructure.Follows, key)
+		}
+	}
+	for key, relation := range dbStructure.Relations {
+		if relation.UserId == id || relation.TargetId == id {
+			delete(dbStructure.Relations, key)
+		}
+	}
+	// Notifications the user caused for others stay, but no longer name them. Messages that
+	// don't start with the actor's name can't be rewritten and are dropped
+	for key, notification := range dbStructure.Notifications {
+		if notification.UserId == id {
+			delete(dbStructure.Notifications, key)
+			continue
+		}
+		if notification.ActorId != id {
+			continue
+		}
+		if !strings.HasPrefix(notification.Message, actorName+" ") {
+			delete(dbStructure.Notifications, key)
+			continue
+		}
+		notification.ActorId = 0
+		notification.Message = "A deleted user" + strings.TrimPrefix(notification.Message, actorName)
+		dbStructure.Notifications[key] = notification
+	}
+	for key, session := range dbStructure.Sessions {
+		if session.UserId == id {
+			delete(dbStructure.Sessions, key)
+		}
+	}
+	for key, reset := range dbStructure.PasswordResets {
+		if reset.UserId == id {
+			delete(dbStructure.PasswordResets, key)
+		}
+	}
+	// Nothing is left to review: pending items on the account or its deleted chirps are dropped
+	// and open reports about them resolved
+	for key, item := range dbStructure.ModerationItems {
+		if item.Status == ItemPending && (item.UserId == id || deletedIds[item.ChirpId]) {
+			delete(dbStructure.ModerationItems, key)
+		}
+	}
+	for key, report := range dbStructure.Reports {
+		if report.Status == ReportOpen && (report.UserId == id || deletedIds[report.ChirpId]) {
+			report.Status = ReportResolved
+			dbStructure.Reports[key] = report
+		}
+	}
+	db.writeDB(dbStructure)
+	return deleted, nil
+}
+
+// anonymousUser returns the id of the anonymous account, creating it on first use
+func (dbStructure *DBStructure) anonymousUser() int {
+	nextId := 1
+	for _, user := range dbStructure.Users {
+		if user.Anonymous {
+			return user.Id
+		}
+		if user.Id >= nextId {
+			nextId = user.Id + 1
+		}
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = make(map[int]User)
+	}
+	dbStructure.Users[nextId-1] = User{Id: nextId, DisplayName: "Deleted user", Anonymous: true}
+	return nextId
+}
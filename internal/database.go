@@ -1,38 +1,109 @@
 package Database
 
 import (
+	"chirpy/internal/passwords"
 	"encoding/json"
 	"errors"
 	"io/fs"
 	"os"
 	"sync"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type DB struct {
 	path string
-	mux  *sync.RWMutex
+}
+
+// Every DB shares these locks, there is only one database file. fileMux guards reading and
+// writing the file, writeMux is held from loading to writing a change so that concurrent
+// changes, background jobs included, can't overwrite each other
+var (
+	fileMux  sync.RWMutex
+	writeMux sync.Mutex
+)
+
+// lockWrites holds off every other change until the returned function is called
+func (db *DB) lockWrites() func() {
+	writeMux.Lock()
+	return writeMux.Unlock
 }
 
 type DBStructure struct {
-	Chirps      map[int]Chirp      `json:"chirps"`
-	Users       map[int]User       `json:"users"`
-	Revocations map[int]Revocation `json:"revocations"`
+	Chirps          map[int]Chirp          `json:"chirps"`
+	Users           map[int]User           `json:"users"`
+	Revocations     map[int]Revocation     `json:"revocations"`
+	ModerationItems map[int]ModerationItem `json:"moderation_items"`
+	ModerationAudit map[int]AuditEntry     `json:"moderation_audit"`
+	Notifications   map[int]Notification   `json:"notifications"`
+	Reports         map[int]Report         `json:"reports"`
+	Follows         map[int]Follow         `json:"follows"`
+	ChirpsByAuthor  map[int][]int          `json:"chirps_by_author"`
+	Relations       map[int]Relation       `json:"relations"`
+	Likes           map[int]Like           `json:"likes"`
+	PasswordResets  map[int]PasswordReset  `json:"password_resets"`
+	Sessions        map[int]Session        `json:"sessions"`
 }
 
 type Chirp struct {
-	Id       int
-	Body     string
-	AuthorId int
+	Id         int
+	Body       string
+	AuthorId   int
+	CreatedAt  time.Time
+	DeletedAt  *time.Time
+	Status     string
+	Moderation []ModerationDecision
+	Visibility string
+	Mentions   []int
+	ReplyToId  int
+}
+
+// ModerationDecision records a moderation rule that matched a chirp when it was created
+type ModerationDecision struct {
+	Rule   string
+	Action string
+	Reason string
 }
 
+const (
+	ChirpPublished = "published"
+	ChirpHeld      = "held"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+)
+
 type User struct {
 	Id          int
 	Email       string
 	Password    string
 	IsChirpyRed bool
+	Role        string
+	Hidden      bool
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+	Verified    bool
+	// PendingEmail is the email the user asked to change to, until they confirm it
+	PendingEmail string
+
+	VerificationSentAt      time.Time
+	NotificationPreferences map[string]bool
+	TokensValidAfter        time.Time
+
+	// Anonymous marks the placeholder account that chirps of deleted users are reassigned to
+	Anonymous bool
+	// Deleted users are an empty record keeping their id taken
+	Deleted bool
+
+	TOTPSecret        string
+	TOTPPendingSecret string
+	TOTPEnabled       bool
+	TOTPLastCounter   int64
+	RecoveryCodes     []string
 }
 
 type Revocation struct {
@@ -42,10 +113,20 @@ type Revocation struct {
 
 const filename = "database.json"
 
+// PasswordHasher hashes every password the database stores, it is set up once at startup
+var PasswordHasher passwords.Hasher = passwords.Bcrypt{Cost: 10}
+
+var (
+	ErrChirpNotFound     = errors.New("Chirp not found")
+	ErrChirpNotDeletable = errors.New("Chirp not possible to delete")
+	ErrRestoreExpired    = errors.New("Chirp restore window expired")
+	ErrUserNotFound      = errors.New("User not found")
+)
+
 // NewDB creates a new database connection
 // and creates the database file if it doesn't exist
 func NewDB(path string) (*DB, error) {
-	var db = &DB{path: path, mux: &sync.RWMutex{}}
+	var db = &DB{path: path}
 	_, err := os.Stat(path + filename)
 	if os.IsNotExist(err) {
 		db.ensureDB()
@@ -53,72 +134,154 @@ func NewDB(path string) (*DB, error) {
 	return db, nil
 }
 
-// CreateChirp creates a new chirp and saves it to disk
-func (db *DB) CreateChirp(body string, author int) (Chirp, error) {
-	var chirp Chirp
+// CreateChirp assigns an id to chirp and saves it to disk
+func (db *DB) CreateChirp(chirp Chirp) (Chirp, error) {
+	defer db.lockWrites()()
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return chirp, err
 	}
-	chirps, err := db.GetChirps(nil)
-	if err != nil {
-		return chirp, err
+	// The author may have deleted their account while still holding a valid token
+	authorFound := false
+	for _, user := range dbStructure.Users {
+		if user.Id == chirp.AuthorId && !user.Deleted {
+			authorFound = true
+		}
+	}
+	if !authorFound {
+		return chirp, ErrUserNotFound
+	}
+	// Deleted chirps still hold their id until purged, so look at every record
+	chirp.Id = 1
+	for _, existing := range dbStructure.Chirps {
+		if existing.Id >= chirp.Id {
+			chirp.Id = existing.Id + 1
+		}
+	}
+	chirp.CreatedAt = time.Now()
+	if chirp.Visibility == "" {
+		chirp.Visibility = VisibilityPublic
 	}
-	if len(chirps) > 0 {
-		chirp.Id = chirps[len(chirps)-1].Id + 1
-	} else {
-		chirp.Id = 1
+	if chirp.Status == "" {
+		chirp.Status = ChirpPublished
 	}
-	chirp.Body = body
-	chirp.AuthorId = author
 	if len(dbStructure.Chirps) == 0 {
 		dbStructure.Chirps = make(map[int]Chirp)
 	}
+	index := dbStructure.chirpIndex()
 	dbStructure.Chirps[chirp.Id-1] = chirp
+	index[chirp.AuthorId] = append(index[chirp.AuthorId], chirp.Id)
 	db.writeDB(dbStructure)
 	return chirp, nil
 }
 
-func (db *DB) DeleteChirp(id, authorId int) error {
-	var chirps []Chirp
+// DeleteChirp moves a chirp of authorId to the trash, whatever its status or visibility, and
+// returns it. It can be restored until it is purged
+func (db *DB) DeleteChirp(id, authorId int) (Chirp, error) {
+	defer db.lockWrites()()
 	dbStructure, err := db.loadDB()
 	if err != nil {
-		return err
+		return Chirp{}, err
 	}
-	for _, chirp := range dbStructure.Chirps {
-		chirps = append(chirps, chirp)
-	}
-	for i, chirp := range chirps {
-		if chirp.Id == id && chirp.AuthorId == authorId {
-			chirps = append(chirps[:i], chirps[i+1:]...)
-			dbStructure.Chirps = make(map[int]Chirp, len(chirps))
-			for i := 0; i < len(chirps); i++ {
-				dbStructure.Chirps[i] = chirps[i]
+	for key, chirp := range dbStructure.Chirps {
+		if chirp.Id == id && chirp.AuthorId == authorId && chirp.DeletedAt == nil {
+			now := time.Now()
+			chirp.DeletedAt = &now
+			dbStructure.Chirps[key] = chirp
+			db.writeDB(dbStructure)
+			return chirp, nil
+		}
+	}
+	return Chirp{}, ErrChirpNotDeletable
+}
+
+// RestoreChirp takes a chirp out of the trash if it was deleted less than retention ago
+func (db *DB) RestoreChirp(id, authorId int, retention time.Duration) (Chirp, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Chirp{}, err
+	}
+	for key, chirp := range dbStructure.Chirps {
+		if chirp.Id == id && chirp.AuthorId == authorId && chirp.DeletedAt != nil {
+			if time.Since(*chirp.DeletedAt) > retention {
+				return Chirp{}, ErrRestoreExpired
 			}
+			chirp.DeletedAt = nil
+			dbStructure.Chirps[key] = chirp
 			db.writeDB(dbStructure)
-			return nil
+			return chirp, nil
 		}
 	}
-	return errors.New("Chirp not possible to delete")
+	return Chirp{}, ErrChirpNotFound
 }
 
-func (db *DB) GetChirp(id int) (Chirp, error) {
+// GetDeletedChirps returns the chirps of an author that are in the trash
+func (db *DB) GetDeletedChirps(authorId int) ([]Chirp, error) {
+	var chirps []Chirp
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return chirps, err
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorId == authorId && chirp.DeletedAt != nil {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+// PurgeChirps permanently removes chirps deleted more than retention ago
+func (db *DB) PurgeChirps(retention time.Duration) (int, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for key, chirp := range dbStructure.Chirps {
+		if chirp.DeletedAt != nil && time.Since(*chirp.DeletedAt) > retention {
+			delete(dbStructure.Chirps, key)
+			dbStructure.removeFromIndex(chirp)
+			purged++
+		}
+	}
+	if purged > 0 {
+		db.writeDB(dbStructure)
+	}
+	return purged, nil
+}
+
+func (dbStructure *DBStructure) removeFromIndex(chirp Chirp) {
+	index := dbStructure.chirpIndex()
+	ids := index[chirp.AuthorId]
+	for i, id := range ids {
+		if id == chirp.Id {
+			index[chirp.AuthorId] = append(ids[:i], ids[i+1:]...)
+			return
+		}
+	}
+}
+
+// GetChirp returns a chirp if viewerId can see it, viewerId is -1 for anonymous readers
+func (db *DB) GetChirp(viewerId, id int) (Chirp, error) {
 	var chirp Chirp
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return chirp, err
 	}
 
+	hidden := dbStructure.hiddenAuthors()
 	for _, chirp := range dbStructure.Chirps {
-		if chirp.Id == id {
+		if chirp.Id == id && chirp.isVisible() && !hidden[chirp.AuthorId] && dbStructure.canView(viewerId, chirp) {
 			return chirp, nil
 		}
 	}
-	return chirp, errors.New("Chirp not found")
+	return chirp, ErrChirpNotFound
 }
 
-// GetChirps returns all chirps in the database
-func (db *DB) GetChirps(authorId *int) ([]Chirp, error) {
+// GetChirps returns all chirps in the database that viewerId can see, viewerId is -1 for anonymous readers
+func (db *DB) GetChirps(viewerId int, authorId *int) ([]Chirp, error) {
 	var chirps []Chirp
 	dbStructure, err := db.loadDB()
 	if err != nil {
@@ -129,7 +292,11 @@ func (db *DB) GetChirps(authorId *int) ([]Chirp, error) {
 	if authorId != nil {
 		sortByAuthor = true
 	}
+	hidden := dbStructure.hiddenAuthors()
 	for _, chirp := range dbStructure.Chirps {
+		if !chirp.isVisible() || hidden[chirp.AuthorId] || !dbStructure.canView(viewerId, chirp) {
+			continue
+		}
 		if sortByAuthor && *authorId == chirp.AuthorId {
 			chirps = append(chirps, chirp)
 		} else if !sortByAuthor {
@@ -140,33 +307,72 @@ func (db *DB) GetChirps(authorId *int) ([]Chirp, error) {
 	return chirps, nil
 }
 
+// isVisible reports whether a chirp is neither in the trash nor waiting on moderation.
+// Chirps stored before moderation existed have no status and count as published
+func (c Chirp) isVisible() bool {
+	return c.DeletedAt == nil && (c.Status == "" || c.Status == ChirpPublished)
+}
+
+// canView reports whether viewerId may read chirp given its visibility. Authors always see
+// their chirps, chirps stored before visibility existed are public
+func (dbStructure DBStructure) canView(viewerId int, chirp Chirp) bool {
+	if chirp.Visibility == "" || chirp.Visibility == VisibilityPublic || chirp.AuthorId == viewerId {
+		return true
+	}
+	if viewerId == -1 {
+		return false
+	}
+	for _, mentioned := range chirp.Mentions {
+		if mentioned == viewerId {
+			return true
+		}
+	}
+	if chirp.Visibility == VisibilityFollowers {
+		for _, follow := range dbStructure.Follows {
+			if follow.FollowerId == viewerId && follow.FolloweeId == chirp.AuthorId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hiddenAuthors returns the ids of the users hidden after being reported
+func (dbStructure DBStructure) hiddenAuthors() map[int]bool {
+	hidden := make(map[int]bool)
+	for _, user := range dbStructure.Users {
+		if user.Hidden {
+			hidden[user.Id] = true
+		}
+	}
+	return hidden
+}
+
 func (db *DB) CreateUser(email, password string) (User, error) {
+	defer db.lockWrites()()
 	var user User
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return user, err
 	}
-	users, err := db.GetUsers()
-	if err != nil {
-		return user, err
-	}
-	if len(users) > 0 {
-		user.Id = users[len(users)-1].Id + 1
-	} else {
-		user.Id = 1
-	}
-	for _, user := range users {
-		if user.Email == email {
-			return user, errors.New("User already existing")
+	// Deleted users still hold their id, so ids are counted over every record
+	user.Id = 1
+	for _, existing := range dbStructure.Users {
+		if existing.Id >= user.Id {
+			user.Id = existing.Id + 1
 		}
 	}
+	if dbStructure.emailTaken(email, 0) {
+		return user, ErrEmailTaken
+	}
 	user.Email = email
 	user.IsChirpyRed = false
-	encryptedPass, err := bcrypt.GenerateFromPassword([]byte(password), 0)
+	user.Role = RoleUser
+	encryptedPass, err := PasswordHasher.Hash(password)
 	if err != nil {
 		return user, err
 	}
-	user.Password = string(encryptedPass)
+	user.Password = encryptedPass
 	if len(dbStructure.Users) == 0 {
 		dbStructure.Users = make(map[int]User)
 	}
@@ -175,41 +381,80 @@ func (db *DB) CreateUser(email, password string) (User, error) {
 	return user, nil
 }
 
+// UpdateUser changes the email, premium status and, when password isn't nil, the password of a user.
+// Every other field of the user is kept as it is
 func (db *DB) UpdateUser(id int, email string, password *string, isChirpyRed bool) (User, error) {
+	defer db.lockWrites()()
 	var modUser User
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return modUser, err
 	}
-	users, err := db.GetUsers()
-	if err != nil {
-		return modUser, err
-	}
-	for i, user := range users {
-		if user.Id == id {
-			users = append(users[:i], users[i+1:]...)
-			if password != nil {
-				encryptedPass, err := bcrypt.GenerateFromPassword([]byte(*password), 0)
-				if err != nil {
-					return modUser, err
-				}
-				modUser.Password = string(encryptedPass)
-			} else {
-				modUser.Password = user.Password
+	for key, user := range dbStructure.Users {
+		if user.Id != id || user.Deleted {
+			continue
+		}
+		modUser = user
+		if password != nil {
+			encryptedPass, err := PasswordHasher.Hash(*password)
+			if err != nil {
+				return modUser, err
 			}
-			break
+			modUser.Password = encryptedPass
+		}
+		if modUser.Email != email {
+			modUser.Verified = false
 		}
+		modUser.Email = email
+		modUser.IsChirpyRed = isChirpyRed
+		dbStructure.Users[key] = modUser
+		db.writeDB(dbStructure)
+		return modUser, nil
 	}
-	modUser.Id = id
-	modUser.Email = email
-	modUser.IsChirpyRed = isChirpyRed
-	users = append(users, modUser)
-	dbStructure.Users = make(map[int]User, len(users))
-	for i := 0; i < len(users); i++ {
-		dbStructure.Users[i] = users[i]
+	return modUser, ErrUserNotFound
+}
+
+// updateUser applies update to the user with the given id and saves it
+func (db *DB) updateUser(id int, update func(user *User) error) (User, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	user, err := dbStructure.modifyUser(id, update)
+	if err != nil {
+		return User{}, err
 	}
 	db.writeDB(dbStructure)
-	return modUser, nil
+	return user, nil
+}
+
+// modifyUser applies update to the user with the given id in memory, callers save it
+func (dbStructure *DBStructure) modifyUser(id int, update func(user *User) error) (User, error) {
+	for key, user := range dbStructure.Users {
+		if user.Id != id || user.Deleted {
+			continue
+		}
+		if err := update(&user); err != nil {
+			return User{}, err
+		}
+		dbStructure.Users[key] = user
+		return user, nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+// RehashPassword stores password, already verified against the current hash, with the current hasher
+func (db *DB) RehashPassword(id int, password string) error {
+	hash, err := PasswordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.updateUser(id, func(user *User) error {
+		user.Password = hash
+		return nil
+	})
+	return err
 }
 
 func (db *DB) GetUser(id int) (User, error) {
@@ -220,13 +465,14 @@ func (db *DB) GetUser(id int) (User, error) {
 	}
 
 	for _, user := range dbStructure.Users {
-		if user.Id == id {
+		if user.Id == id && !user.Deleted {
 			return user, nil
 		}
 	}
-	return user, errors.New("Chirp not found")
+	return user, ErrUserNotFound
 }
 
+// GetUsers returns every user, deleted users left out
 func (db *DB) GetUsers() ([]User, error) {
 	var users []User
 	dbStructure, err := db.loadDB()
@@ -234,12 +480,16 @@ func (db *DB) GetUsers() ([]User, error) {
 		return users, err
 	}
 	for _, user := range dbStructure.Users {
+		if user.Deleted {
+			continue
+		}
 		users = append(users, user)
 	}
 	return users, nil
 }
 
 func (db *DB) RevokeToken(token string) error {
+	defer db.lockWrites()()
 	var revocation Revocation
 	dbStructure, err := db.loadDB()
 	if err != nil {
@@ -249,6 +499,11 @@ func (db *DB) RevokeToken(token string) error {
 	if err != nil {
 		return err
 	}
+	for _, revoked := range revocations {
+		if revoked.Token == token {
+			return ErrTokenRevoked
+		}
+	}
 	revocation.Token = token
 	revocation.Time = time.Now()
 	revocations = append(revocations, revocation)
@@ -285,8 +540,8 @@ func (db *DB) ensureDB() error {
 // loadDB reads the database file into memory
 func (db *DB) loadDB() (DBStructure, error) {
 	var dbStructure DBStructure
-	db.mux.RLock()
-	defer db.mux.RUnlock()
+	fileMux.RLock()
+	defer fileMux.RUnlock()
 	data, err := os.ReadFile(db.path + filename)
 	if err != nil {
 		return dbStructure, err
@@ -297,8 +552,8 @@ func (db *DB) loadDB() (DBStructure, error) {
 
 // writeDB writes the database file to disk
 func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mux.Lock()
-	defer db.mux.Unlock()
+	fileMux.Lock()
+	defer fileMux.Unlock()
 	data, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
@@ -0,0 +1,30 @@
+package Database
+
+import (
+	"chirpy/internal/passwords"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestDB opens an empty database in a directory of its own
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	// The cheapest cost keeps the tests fast, the stored hashes aren't the point
+	PasswordHasher = passwords.Bcrypt{Cost: bcrypt.MinCost}
+	db, err := NewDB(t.TempDir() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestUser creates a user with the password "password1"
+func newTestUser(t *testing.T, db *DB, email string) User {
+	t.Helper()
+	user, err := db.CreateUser(email, "password1")
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %s", email, err)
+	}
+	return user
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ChirpCreated        = "chirp.created"
+	ChirpDeleted        = "chirp.deleted"
+	ChirpRestored       = "chirp.restored"
+	NotificationCreated = "notification.created"
+)
+
+// Event is something that happened to a chirp or, for notification events, to the user
+// in UserId. Id grows by one with every published event
+type Event struct {
+	Id             uint64    `json:"id"`
+	Type           string    `json:"type"`
+	ChirpId        int       `json:"chirp_id,omitempty"`
+	AuthorId       int       `json:"author_id,omitempty"`
+	ReplyToId      int       `json:"reply_to_id,omitempty"`
+	Body           string    `json:"body,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Visibility     string    `json:"visibility,omitempty"`
+	UserId         int       `json:"-"`
+	NotificationId int       `json:"notification_id,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// IsChirpEvent reports whether the event is about a chirp rather than addressed to one user
+func (e Event) IsChirpEvent() bool {
+	return e.Type != NotificationCreated
+}
+
+// Bus fans events out to subscribers and keeps the latest ones in a ring buffer so
+// subscribers can resume from the last event they saw
+type Bus struct {
+	mux         *sync.Mutex
+	nextId      uint64
+	ring        []Event
+	start       int
+	subscribers map[chan Event]struct{}
+	bufferSize  int
+}
+
+// NewBus creates a bus remembering the last size events, every subscriber can fall
+// bufferSize events behind before it is dropped
+func NewBus(size, bufferSize int) *Bus {
+	return &Bus{
+		mux:         &sync.Mutex{},
+		nextId:      1,
+		ring:        make([]Event, 0, size),
+		subscribers: make(map[chan Event]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Publish assigns the event its id and time and sends it to every subscriber. Subscribers
+// whose buffer is full are too slow to keep up: their channel is closed so they can resume
+func (b *Bus) Publish(event Event) Event {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	event.Id = b.nextId
+	b.nextId++
+	event.Time = time.Now()
+
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, event)
+	} else if cap(b.ring) > 0 {
+		b.ring[b.start] = event
+		b.start = (b.start + 1) % cap(b.ring)
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return event
+}
+
+// Subscribe returns a channel with the events published from now on and the buffered
+// events with an id greater than lastId. unsubscribe must be called once done
+func (b *Bus) Subscribe(lastId uint64) (events <-chan Event, missed []Event, unsubscribe func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for i := 0; i < len(b.ring); i++ {
+		event := b.ring[(b.start+i)%len(b.ring)]
+		if lastId > 0 && event.Id > lastId {
+			missed = append(missed, event)
+		}
+	}
+
+	subscriber := make(chan Event, b.bufferSize)
+	b.subscribers[subscriber] = struct{}{}
+	return subscriber, missed, func() {
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		if _, ok := b.subscribers[subscriber]; ok {
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package Database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrAlreadyFollowing = errors.New("Already following this user")
+	ErrNotFollowing     = errors.New("Not following this user")
+)
+
+type Follow struct {
+	Id         int
+	FollowerId int
+	FolloweeId int
+	CreatedAt  time.Time
+}
+
+func (db *DB) FollowUser(followerId, followeeId int) (Follow, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Follow{}, err
+	}
+	if dbStructure.isBlockedBy(followeeId, followerId) {
+		return Follow{}, ErrBlocked
+	}
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = make(map[int]Follow)
+	}
+	nextId := 1
+	for _, follow := range dbStructure.Follows {
+		if follow.FollowerId == followerId && follow.FolloweeId == followeeId {
+			return follow, ErrAlreadyFollowing
+		}
+		if follow.Id >= nextId {
+			nextId = follow.Id + 1
+		}
+	}
+	follow := Follow{Id: nextId, FollowerId: followerId, FolloweeId: followeeId, CreatedAt: time.Now()}
+	dbStructure.Follows[follow.Id] = follow
+	db.writeDB(dbStructure)
+	return follow, nil
+}
+
+func (db *DB) UnfollowUser(followerId, followeeId int) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, follow := range dbStructure.Follows {
+		if follow.FollowerId == followerId && follow.FolloweeId == followeeId {
+			delete(dbStructure.Follows, key)
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrNotFollowing
+}
+
+// GetFollowers returns the follows pointing at a user, newest first
+func (db *DB) GetFollowers(userId int) ([]Follow, error) {
+	return db.getFollows(func(follow Follow) bool { return follow.FolloweeId == userId })
+}
+
+// GetFollowing returns the follows a user made, newest first
+func (db *DB) GetFollowing(userId int) ([]Follow, error) {
+	return db.getFollows(func(follow Follow) bool { return follow.FollowerId == userId })
+}
+
+func (db *DB) getFollows(match func(Follow) bool) ([]Follow, error) {
+	var follows []Follow
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return follows, err
+	}
+	for _, follow := range dbStructure.Follows {
+		if match(follow) {
+			follows = append(follows, follow)
+		}
+	}
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].Id > follows[j].Id
+	})
+	return follows, nil
+}
+
+// GetTimeline returns up to limit visible chirps by the user and the accounts they follow
+// and haven't blocked or muted, newest first, with an id lower than before when before is greater than 0.
+// It walks the per-author chirp index backwards instead of scanning every chirp
+func (db *DB) GetTimeline(userId, before, limit int) ([]Chirp, error) {
+	var chirps []Chirp
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return chirps, err
+	}
+	index := dbStructure.chirpIndex()
+	hidden := dbStructure.hiddenAuthors()
+	excluded := dbStructure.excludedAuthors(userId, true)
+
+	authors := []int{userId}
+	for _, follow := range dbStructure.Follows {
+		if follow.FollowerId == userId && !excluded[follow.FolloweeId] {
+			authors = append(authors, follow.FolloweeId)
+		}
+	}
+
+	// One position per author, pointing at the newest chirp id below the cursor
+	positions := make([]int, len(authors))
+	for i, author := range authors {
+		ids := index[author]
+		positions[i] = sort.SearchInts(ids, before) - 1
+		if before <= 0 {
+			positions[i] = len(ids) - 1
+		}
+	}
+
+	for len(chirps) < limit {
+		newest := -1
+		for i, author := range authors {
+			if positions[i] < 0 {
+				continue
+			}
+			if newest == -1 || index[author][positions[i]] > index[authors[newest]][positions[newest]] {
+				newest = i
+			}
+		}
+		if newest == -1 {
+			break
+		}
+		chirpId := index[authors[newest]][positions[newest]]
+		positions[newest]--
+		chirp, ok := dbStructure.chirpById(chirpId)
+		if ok && chirp.isVisible() && !hidden[chirp.AuthorId] && dbStructure.canView(userId, chirp) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+// chirpIndex returns the ids of every chirp by author in ascending order, building it
+// from the chirps when the database predates the index
+func (dbStructure *DBStructure) chirpIndex() map[int][]int {
+	if dbStructure.ChirpsByAuthor != nil {
+		return dbStructure.ChirpsByAuthor
+	}
+	index := make(map[int][]int)
+	for _, chirp := range dbStructure.Chirps {
+		index[chirp.AuthorId] = append(index[chirp.AuthorId], chirp.Id)
+	}
+	for _, ids := range index {
+		sort.Ints(ids)
+	}
+	dbStructure.ChirpsByAuthor = index
+	return index
+}
+
+// chirpById looks the chirp up by its key first, chirps are stored under their id minus one
+func (dbStructure DBStructure) chirpById(id int) (Chirp, bool) {
+	if chirp, ok := dbStructure.Chirps[id-1]; ok && chirp.Id == id {
+		return chirp, true
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.Id == id {
+			return chirp, true
+		}
+	}
+	return Chirp{}, false
+}
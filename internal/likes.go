@@ -0,0 +1,58 @@
+package Database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrAlreadyLiked = errors.New("Chirp already liked")
+	ErrNotLiked     = errors.New("Chirp not liked")
+)
+
+type Like struct {
+	Id        int
+	UserId    int
+	ChirpId   int
+	CreatedAt time.Time
+}
+
+func (db *DB) LikeChirp(userId, chirpId int) (Like, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Like{}, err
+	}
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = make(map[int]Like)
+	}
+	nextId := 1
+	for _, like := range dbStructure.Likes {
+		if like.UserId == userId && like.ChirpId == chirpId {
+			return like, ErrAlreadyLiked
+		}
+		if like.Id >= nextId {
+			nextId = like.Id + 1
+		}
+	}
+	like := Like{Id: nextId, UserId: userId, ChirpId: chirpId, CreatedAt: time.Now()}
+	dbStructure.Likes[like.Id] = like
+	db.writeDB(dbStructure)
+	return like, nil
+}
+
+func (db *DB) UnlikeChirp(userId, chirpId int) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, like := range dbStructure.Likes {
+		if like.UserId == userId && like.ChirpId == chirpId {
+			delete(dbStructure.Likes, key)
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrNotLiked
+}
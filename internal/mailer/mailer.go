@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users
+type Mailer interface {
+	Send(message Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server, with PLAIN auth when Username is set
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	data := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		m.From, message.To, message.Subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, []byte(data))
+}
+
+// FileMailer appends every email to a file instead of sending it, for development and tests
+type FileMailer struct {
+	Path string
+	mux  sync.Mutex
+}
+
+func (m *FileMailer) Send(message Message) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "To: %s\nSubject: %s\nDate: %s\n\n%s\n\n", message.To, message.Subject, time.Now().Format(time.RFC3339), message.Body)
+	return err
+}
+
+// LogMailer writes every email to the log instead of sending it
+type LogMailer struct{}
+
+func (LogMailer) Send(message Message) error {
+	log.Printf("Email to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
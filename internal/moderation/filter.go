@@ -0,0 +1,184 @@
+package moderation
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const mask = "****"
+
+// ErrInvalidWord is returned for entries Mask could never match, such as phrases or punctuation
+var ErrInvalidWord = errors.New("Words may only contain letters and digits")
+
+// DefaultWords is the word list used when no list file is configured
+var DefaultWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// Filter masks profane words in text, its word list can be changed at runtime
+type Filter struct {
+	path  string
+	mux   *sync.RWMutex
+	words map[string]struct{}
+}
+
+// NewFilter creates a filter for the given words that is not backed by a file
+func NewFilter(words []string) *Filter {
+	filter := &Filter{mux: &sync.RWMutex{}, words: make(map[string]struct{})}
+	filter.add(words)
+	return filter
+}
+
+// LoadFilter reads a word list, one word per line, and keeps the path so changes are saved back.
+// When the file doesn't exist yet the filter starts with DefaultWords
+func LoadFilter(path string) (*Filter, error) {
+	filter := NewFilter(nil)
+	filter.path = path
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		filter.add(DefaultWords)
+		return filter, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	filter.add(words)
+	return filter, nil
+}
+
+// Words returns the word list sorted alphabetically
+func (f *Filter) Words() []string {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	words := make([]string, 0, len(f.words))
+	for word := range f.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Add adds words to the list and saves it when the filter is backed by a file. Nothing is
+// added if one of the words isn't a ValidWord
+func (f *Filter) Add(words ...string) error {
+	for _, word := range words {
+		if !ValidWord(word) {
+			return ErrInvalidWord
+		}
+	}
+	f.add(words)
+	return f.save()
+}
+
+// Remove removes words from the list and saves it when the filter is backed by a file
+func (f *Filter) Remove(words ...string) error {
+	f.mux.Lock()
+	for _, word := range words {
+		delete(f.words, fold(word))
+	}
+	f.mux.Unlock()
+	return f.save()
+}
+
+// Mask replaces every listed word in text with asterisks. Words are matched ignoring case,
+// accents and surrounding punctuation, everything else in text is left untouched
+func (f *Filter) Mask(text string) string {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	if len(f.words) == 0 {
+		return text
+	}
+
+	var masked strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start == -1 {
+			return
+		}
+		word := text[start:end]
+		if _, ok := f.words[fold(word)]; ok {
+			masked.WriteString(mask)
+		} else {
+			masked.WriteString(word)
+		}
+		start = -1
+	}
+	for i, char := range text {
+		if isWordChar(char) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		masked.WriteRune(char)
+	}
+	flush(len(text))
+	return masked.String()
+}
+
+func (f *Filter) add(words []string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, word := range words {
+		if folded := fold(strings.TrimSpace(word)); folded != "" {
+			f.words[folded] = struct{}{}
+		}
+	}
+}
+
+func (f *Filter) save() error {
+	if f.path == "" {
+		return nil
+	}
+	return os.WriteFile(f.path, []byte(strings.Join(f.Words(), "\n")+"\n"), 0644)
+}
+
+// ValidWord reports whether word is a single word Mask can match, surrounding spaces aside
+func ValidWord(word string) bool {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return false
+	}
+	for _, char := range word {
+		if !isWordChar(char) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsNumber(char) || unicode.Is(unicode.Mn, char)
+}
+
+// fold lowercases a word and strips its accents so "Fórnax" and "fornax" compare equal
+func fold(word string) string {
+	var folded strings.Builder
+	for _, char := range norm.NFD.String(word) {
+		if unicode.Is(unicode.Mn, char) {
+			continue
+		}
+		folded.WriteRune(unicode.ToLower(char))
+	}
+	return folded.String()
+}
@@ -0,0 +1,317 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Action is what a check wants done with a post, ordered from least to most severe
+type Action int
+
+const (
+	Allow Action = iota
+	Flag
+	Mask
+	Hold
+	Reject
+)
+
+var actionNames = map[Action]string{Allow: "allow", Flag: "flag", Mask: "mask", Hold: "hold", Reject: "reject"}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// ParseAction converts the name of an action back into an Action
+func ParseAction(name string) (Action, error) {
+	for action, actionName := range actionNames {
+		if actionName == strings.ToLower(name) {
+			return action, nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown moderation action %q", name)
+}
+
+// Post is what the checks look at, Recent holds the author's latest posts with their time
+type Post struct {
+	AuthorId int
+	Body     string
+	Recent   []RecentPost
+}
+
+type RecentPost struct {
+	Body      string
+	CreatedAt time.Time
+}
+
+// Decision is the outcome of a check that matched, Body is only set by Mask decisions
+type Decision struct {
+	Rule   string
+	Action Action
+	Reason string
+	Body   string
+}
+
+// Check is a single moderation rule, it returns nil when the post doesn't match
+type Check interface {
+	Name() string
+	Check(post Post) *Decision
+}
+
+// Result is the outcome of running a post through the pipeline
+type Result struct {
+	Action    Action
+	Body      string
+	Decisions []Decision
+}
+
+// Pipeline runs every check in order and counts how many times each rule matched
+type Pipeline struct {
+	checks []Check
+	mux    *sync.Mutex
+	hits   map[string]int
+}
+
+func NewPipeline(checks ...Check) *Pipeline {
+	return &Pipeline{checks: checks, mux: &sync.Mutex{}, hits: make(map[string]int)}
+}
+
+// Run passes the post through every check. Masks are applied before the next check runs
+// and the result carries the most severe action of all the decisions
+func (p *Pipeline) Run(post Post) Result {
+	result := Result{Action: Allow, Body: post.Body}
+	for _, check := range p.checks {
+		decision := check.Check(post)
+		if decision == nil {
+			continue
+		}
+		if decision.Action == Mask {
+			post.Body = decision.Body
+			result.Body = decision.Body
+		}
+		if decision.Action > result.Action {
+			result.Action = decision.Action
+		}
+		result.Decisions = append(result.Decisions, *decision)
+		p.mux.Lock()
+		p.hits[decision.Rule]++
+		p.mux.Unlock()
+	}
+	return result
+}
+
+// Hits returns how many times each rule matched, sorted by rule name
+func (p *Pipeline) Hits() []RuleHits {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	hits := make([]RuleHits, 0, len(p.checks))
+	for _, check := range p.checks {
+		hits = append(hits, RuleHits{Rule: check.Name(), Hits: p.hits[check.Name()]})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Rule < hits[j].Rule
+	})
+	return hits
+}
+
+type RuleHits struct {
+	Rule string
+	Hits int
+}
+
+// RegexRule matches posts against a regular expression
+type RegexRule struct {
+	Rule    string
+	Pattern *regexp.Regexp
+	Action  Action
+}
+
+func (r RegexRule) Name() string {
+	return r.Rule
+}
+
+func (r RegexRule) Check(post Post) *Decision {
+	if !r.Pattern.MatchString(post.Body) {
+		return nil
+	}
+	decision := &Decision{Rule: r.Rule, Action: r.Action, Reason: "Matched " + r.Pattern.String()}
+	if r.Action == Mask {
+		decision.Body = r.Pattern.ReplaceAllString(post.Body, mask)
+	}
+	return decision
+}
+
+// LinkBlocklist matches posts linking to any of the domains or their subdomains
+type LinkBlocklist struct {
+	Domains []string
+	Action  Action
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s]+`)
+
+func (l LinkBlocklist) Name() string {
+	return "link_blocklist"
+}
+
+func (l LinkBlocklist) Check(post Post) *Decision {
+	body := post.Body
+	blocked := false
+	var hosts []string
+	for _, link := range linkPattern.FindAllString(post.Body, -1) {
+		parsed, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+		for _, domain := range l.Domains {
+			domain = strings.ToLower(domain)
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				blocked = true
+				hosts = append(hosts, host)
+				body = strings.ReplaceAll(body, link, mask)
+				break
+			}
+		}
+	}
+	if !blocked {
+		return nil
+	}
+	decision := &Decision{Rule: l.Name(), Action: l.Action, Reason: "Links to " + strings.Join(hosts, ", ")}
+	if l.Action == Mask {
+		decision.Body = body
+	}
+	return decision
+}
+
+// RepeatedCharacters matches posts repeating the same character more than Max times in a row
+type RepeatedCharacters struct {
+	Max    int
+	Action Action
+}
+
+func (r RepeatedCharacters) Name() string {
+	return "repeated_characters"
+}
+
+func (r RepeatedCharacters) Check(post Post) *Decision {
+	var last rune = utf8.RuneError
+	count := 0
+	for _, char := range post.Body {
+		if char == last {
+			count++
+		} else {
+			last = char
+			count = 1
+		}
+		if count > r.Max && char != ' ' {
+			return &Decision{Rule: r.Name(), Action: r.Action, Reason: fmt.Sprintf("Repeats %q more than %d times", char, r.Max)}
+		}
+	}
+	return nil
+}
+
+// DuplicatePost matches posts with the same text as one the author posted within Window
+type DuplicatePost struct {
+	Window time.Duration
+	Action Action
+}
+
+func (d DuplicatePost) Name() string {
+	return "duplicate_post"
+}
+
+func (d DuplicatePost) Check(post Post) *Decision {
+	body := fold(strings.Join(strings.Fields(post.Body), " "))
+	for _, recent := range post.Recent {
+		if time.Since(recent.CreatedAt) > d.Window {
+			continue
+		}
+		if fold(strings.Join(strings.Fields(recent.Body), " ")) == body {
+			return &Decision{Rule: d.Name(), Action: d.Action, Reason: "Same text as a chirp posted at " + recent.CreatedAt.Format(time.RFC3339)}
+		}
+	}
+	return nil
+}
+
+// Config describes the checks of a pipeline, it is read from a JSON file
+type Config struct {
+	Regex []struct {
+		Name    string `json:"name"`
+		Pattern string `json:"pattern"`
+		Action  string `json:"action"`
+	} `json:"regex"`
+	BlockedDomains        []string `json:"blocked_domains"`
+	BlockedDomainsAction  string   `json:"blocked_domains_action"`
+	MaxRepeatedCharacters int      `json:"max_repeated_characters"`
+	RepeatedAction        string   `json:"repeated_action"`
+	DuplicateWindowMins   int      `json:"duplicate_window_minutes"`
+	DuplicateAction       string   `json:"duplicate_action"`
+}
+
+// DefaultConfig flags character spam and rejects duplicates posted within a day
+func DefaultConfig() Config {
+	return Config{
+		MaxRepeatedCharacters: 10,
+		RepeatedAction:        "flag",
+		DuplicateWindowMins:   24 * 60,
+		DuplicateAction:       "reject",
+		BlockedDomainsAction:  "reject",
+	}
+}
+
+// LoadConfig reads a pipeline config, unset fields keep their DefaultConfig value
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// NewPipelineFromConfig builds the checks described by config
+func NewPipelineFromConfig(config Config) (*Pipeline, error) {
+	var checks []Check
+	for _, rule := range config.Regex {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		action, err := ParseAction(rule.Action)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		checks = append(checks, RegexRule{Rule: rule.Name, Pattern: pattern, Action: action})
+	}
+	if len(config.BlockedDomains) > 0 {
+		action, err := ParseAction(config.BlockedDomainsAction)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, LinkBlocklist{Domains: config.BlockedDomains, Action: action})
+	}
+	if config.MaxRepeatedCharacters > 0 {
+		action, err := ParseAction(config.RepeatedAction)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, RepeatedCharacters{Max: config.MaxRepeatedCharacters, Action: action})
+	}
+	if config.DuplicateWindowMins > 0 {
+		action, err := ParseAction(config.DuplicateAction)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, DuplicatePost{Window: time.Duration(config.DuplicateWindowMins) * time.Minute, Action: action})
+	}
+	return NewPipeline(checks...), nil
+}
@@ -0,0 +1,241 @@
+package Database
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ChirpRejected = "rejected"
+	ChirpRemoved  = "removed"
+)
+
+const (
+	ItemPending  = "pending"
+	ItemApproved = "approved"
+	ItemRejected = "rejected"
+	ItemRemoved  = "removed"
+)
+
+var ErrItemNotFound = errors.New("Moderation item not found")
+
+// ModerationItem is a chirp, or when ChirpId is 0 a user account, waiting for a human to review it
+type ModerationItem struct {
+	Id           int
+	ChirpId      int
+	UserId       int
+	Source       string
+	Reason       string
+	Status       string
+	CreatedAt    time.Time
+	ReviewedAt   *time.Time
+	Reviewer     string
+	ReviewerNote string
+}
+
+// AuditEntry records a review action, with a copy of the chirp as it was reviewed
+type AuditEntry struct {
+	Id        int
+	ItemId    int
+	ChirpId   int
+	ChirpBody string
+	AuthorId  int
+	Action    string
+	Reviewer  string
+	Note      string
+	Time      time.Time
+}
+
+// CreateModerationItem queues a chirp, or a user when chirpId is 0, for review.
+// A target only has one pending item at a time
+func (db *DB) CreateModerationItem(chirpId, userId int, source, reason string) (ModerationItem, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return ModerationItem{}, err
+	}
+	if dbStructure.ModerationItems == nil {
+		dbStructure.ModerationItems = make(map[int]ModerationItem)
+	}
+	for _, item := range dbStructure.ModerationItems {
+		if item.ChirpId == chirpId && item.UserId == userId && item.Status == ItemPending {
+			return item, nil
+		}
+	}
+	nextId := 1
+	for _, existing := range dbStructure.ModerationItems {
+		if existing.Id >= nextId {
+			nextId = existing.Id + 1
+		}
+	}
+	item := ModerationItem{
+		Id:        nextId,
+		ChirpId:   chirpId,
+		UserId:    userId,
+		Source:    source,
+		Reason:    reason,
+		Status:    ItemPending,
+		CreatedAt: time.Now(),
+	}
+	dbStructure.ModerationItems[item.Id] = item
+	db.writeDB(dbStructure)
+	return item, nil
+}
+
+// GetModerationItems returns the items with the given status, or every item when status is empty
+func (db *DB) GetModerationItems(status string) ([]ModerationItem, error) {
+	var items []ModerationItem
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return items, err
+	}
+	for _, item := range dbStructure.ModerationItems {
+		if status == "" || item.Status == status {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// ReviewModerationItem closes a pending item with the outcome of the review, updates the
+// chirp or user accordingly, resolves the open reports on it and appends the action to the
+// audit trail. For user items approve shows the account again, reject and remove keep it hidden
+func (db *DB) ReviewModerationItem(id int, outcome, reviewer, note string) (ModerationItem, Chirp, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return ModerationItem{}, Chirp{}, err
+	}
+	item, ok := dbStructure.ModerationItems[id]
+	if !ok || item.Status != ItemPending {
+		return ModerationItem{}, Chirp{}, ErrItemNotFound
+	}
+	if outcome != ItemApproved && outcome != ItemRejected && outcome != ItemRemoved {
+		return ModerationItem{}, Chirp{}, errors.New("Unknown review outcome")
+	}
+
+	var chirp Chirp
+	authorId := item.UserId
+	if item.ChirpId != 0 {
+		chirpKey := -1
+		for key, existing := range dbStructure.Chirps {
+			if existing.Id == item.ChirpId {
+				chirpKey = key
+				break
+			}
+		}
+		if chirpKey == -1 {
+			return ModerationItem{}, Chirp{}, ErrChirpNotFound
+		}
+		chirp = dbStructure.Chirps[chirpKey]
+		switch outcome {
+		case ItemApproved:
+			chirp.Status = ChirpPublished
+		case ItemRejected:
+			chirp.Status = ChirpRejected
+		case ItemRemoved:
+			chirp.Status = ChirpRemoved
+		}
+		dbStructure.Chirps[chirpKey] = chirp
+		authorId = chirp.AuthorId
+	} else {
+		userKey := -1
+		for key, user := range dbStructure.Users {
+			if user.Id == item.UserId {
+				userKey = key
+				break
+			}
+		}
+		if userKey == -1 {
+			return ModerationItem{}, Chirp{}, ErrUserNotFound
+		}
+		user := dbStructure.Users[userKey]
+		user.Hidden = outcome != ItemApproved
+		dbStructure.Users[userKey] = user
+	}
+
+	for key, report := range dbStructure.Reports {
+		if report.ChirpId == item.ChirpId && report.UserId == item.UserId && report.Status == ReportOpen {
+			report.Status = ReportResolved
+			dbStructure.Reports[key] = report
+		}
+	}
+
+	now := time.Now()
+	item.Status = outcome
+	item.ReviewedAt = &now
+	item.Reviewer = reviewer
+	item.ReviewerNote = note
+	dbStructure.ModerationItems[item.Id] = item
+
+	if dbStructure.ModerationAudit == nil {
+		dbStructure.ModerationAudit = make(map[int]AuditEntry)
+	}
+	nextId := 1
+	for _, existing := range dbStructure.ModerationAudit {
+		if existing.Id >= nextId {
+			nextId = existing.Id + 1
+		}
+	}
+	entry := AuditEntry{
+		Id:        nextId,
+		ItemId:    item.Id,
+		ChirpId:   chirp.Id,
+		ChirpBody: chirp.Body,
+		AuthorId:  authorId,
+		Action:    outcome,
+		Reviewer:  reviewer,
+		Note:      note,
+		Time:      now,
+	}
+	dbStructure.ModerationAudit[entry.Id] = entry
+
+	db.writeDB(dbStructure)
+	return item, chirp, nil
+}
+
+// GetModerationAudit returns the audit trail, optionally only for one chirp when chirpId isn't nil
+func (db *DB) GetModerationAudit(chirpId *int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return entries, err
+	}
+	for _, entry := range dbStructure.ModerationAudit {
+		if chirpId == nil || entry.ChirpId == *chirpId {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// GetChirpForReview returns a chirp whatever its status, for moderators to see held chirps
+func (db *DB) GetChirpForReview(id int) (Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Chirp{}, err
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.Id == id {
+			return chirp, nil
+		}
+	}
+	return Chirp{}, ErrChirpNotFound
+}
+
+// GetChirpsForModeration returns the chirps a new chirp of authorId is compared with: the
+// published ones and those held for review, even while the author is hidden
+func (db *DB) GetChirpsForModeration(authorId int) ([]Chirp, error) {
+	var chirps []Chirp
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return chirps, err
+	}
+	for _, id := range dbStructure.chirpIndex()[authorId] {
+		chirp, ok := dbStructure.chirpById(id)
+		if ok && chirp.DeletedAt == nil && (chirp.isVisible() || chirp.Status == ChirpHeld) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
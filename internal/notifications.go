@@ -0,0 +1,178 @@
+package Database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Notification tells a user about something that happened to them or their chirps
+type Notification struct {
+	Id        int
+	UserId    int
+	ActorId   int
+	Type      string
+	ChirpId   int
+	Message   string
+	CreatedAt time.Time
+	ReadAt    *time.Time
+}
+
+const (
+	NotificationModeration = "moderation"
+	NotificationReply      = "reply"
+	NotificationLike       = "like"
+	NotificationFollow     = "follow"
+	NotificationMention    = "mention"
+)
+
+// NotificationTypes are the types users can switch off, moderation outcomes are always sent
+var NotificationTypes = []string{NotificationReply, NotificationLike, NotificationFollow, NotificationMention}
+
+var ErrNotificationNotFound = errors.New("Notification not found")
+
+// CreateNotification stores a notification unless the user switched its type off, in which
+// case it returns false
+func (db *DB) CreateNotification(notification Notification) (Notification, bool, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return notification, false, err
+	}
+	for _, user := range dbStructure.Users {
+		if user.Id == notification.UserId && !user.NotificationEnabled(notification.Type) {
+			return notification, false, nil
+		}
+	}
+	if dbStructure.Notifications == nil {
+		dbStructure.Notifications = make(map[int]Notification)
+	}
+	nextId := 1
+	for _, existing := range dbStructure.Notifications {
+		if existing.Id >= nextId {
+			nextId = existing.Id + 1
+		}
+	}
+	notification.Id = nextId
+	notification.CreatedAt = time.Now()
+	dbStructure.Notifications[notification.Id] = notification
+	db.writeDB(dbStructure)
+	return notification, true, nil
+}
+
+// GetNotifications returns up to limit notifications of a user, newest first, with an id
+// lower than before when before is greater than 0. It also returns the user's unread count
+func (db *DB) GetNotifications(userId, before, limit int, unreadOnly bool) ([]Notification, int, error) {
+	var notifications []Notification
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return notifications, 0, err
+	}
+	unread := 0
+	for _, notification := range dbStructure.Notifications {
+		if notification.UserId != userId {
+			continue
+		}
+		if notification.ReadAt == nil {
+			unread++
+		}
+		if (before > 0 && notification.Id >= before) || (unreadOnly && notification.ReadAt != nil) {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].Id > notifications[j].Id
+	})
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, unread, nil
+}
+
+// MarkNotificationsRead marks notifications of a user as read, every unread one when ids is empty.
+// It returns how many were marked
+func (db *DB) MarkNotificationsRead(userId int, ids []int) (int, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	marked := 0
+	for _, id := range ids {
+		notification, ok := dbStructure.Notifications[id]
+		if !ok || notification.UserId != userId {
+			return 0, ErrNotificationNotFound
+		}
+	}
+	for key, notification := range dbStructure.Notifications {
+		if notification.UserId != userId || notification.ReadAt != nil {
+			continue
+		}
+		if len(ids) > 0 && !containsInt(ids, notification.Id) {
+			continue
+		}
+		notification.ReadAt = &now
+		dbStructure.Notifications[key] = notification
+		marked++
+	}
+	if marked > 0 {
+		db.writeDB(dbStructure)
+	}
+	return marked, nil
+}
+
+// UpdateNotificationPreferences switches notification types on or off for a user
+func (db *DB) UpdateNotificationPreferences(userId int, preferences map[string]bool) (User, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for key, user := range dbStructure.Users {
+		if user.Id != userId {
+			continue
+		}
+		if user.NotificationPreferences == nil {
+			user.NotificationPreferences = make(map[string]bool)
+		}
+		for notificationType, enabled := range preferences {
+			if isConfigurable(notificationType) {
+				user.NotificationPreferences[notificationType] = enabled
+			}
+		}
+		dbStructure.Users[key] = user
+		db.writeDB(dbStructure)
+		return user, nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+// NotificationEnabled reports whether a user gets notifications of a type, types are on by default
+func (u User) NotificationEnabled(notificationType string) bool {
+	enabled, set := u.NotificationPreferences[notificationType]
+	return !set || enabled
+}
+
+func isConfigurable(notificationType string) bool {
+	return containsString(NotificationTypes, notificationType)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
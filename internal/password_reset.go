@@ -0,0 +1,110 @@
+package Database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrResetInvalid = errors.New("Reset token invalid, expired or already used")
+
+// PasswordReset is a single-use reset token, only its hash is stored
+type PasswordReset struct {
+	Id        int
+	UserId    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// CreatePasswordReset stores the hash of a reset token for a user
+func (db *DB) CreatePasswordReset(userId int, tokenHash string, expiresAt time.Time) (PasswordReset, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	if dbStructure.PasswordResets == nil {
+		dbStructure.PasswordResets = make(map[int]PasswordReset)
+	}
+	nextId := 1
+	for _, existing := range dbStructure.PasswordResets {
+		if existing.Id >= nextId {
+			nextId = existing.Id + 1
+		}
+	}
+	reset := PasswordReset{
+		Id:        nextId,
+		UserId:    userId,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	dbStructure.PasswordResets[reset.Id] = reset
+	db.writeDB(dbStructure)
+	return reset, nil
+}
+
+// FindPasswordReset returns the user of a pending, unexpired reset without consuming it
+func (db *DB) FindPasswordReset(tokenHash string) (int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return -1, err
+	}
+	for _, reset := range dbStructure.PasswordResets {
+		if reset.TokenHash == tokenHash && reset.UsedAt == nil && time.Now().Before(reset.ExpiresAt) {
+			return reset.UserId, nil
+		}
+	}
+	return -1, ErrResetInvalid
+}
+
+// UsePasswordReset consumes the reset with the given token hash and returns its user.
+// Every other pending reset of the user is consumed along with it
+func (db *DB) UsePasswordReset(tokenHash string) (int, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return -1, err
+	}
+	userId := -1
+	for _, reset := range dbStructure.PasswordResets {
+		if reset.TokenHash == tokenHash && reset.UsedAt == nil && time.Now().Before(reset.ExpiresAt) {
+			userId = reset.UserId
+			break
+		}
+	}
+	if userId == -1 {
+		return -1, ErrResetInvalid
+	}
+	now := time.Now()
+	for key, reset := range dbStructure.PasswordResets {
+		if reset.UserId == userId && reset.UsedAt == nil {
+			reset.UsedAt = &now
+			dbStructure.PasswordResets[key] = reset
+		}
+	}
+	db.writeDB(dbStructure)
+	return userId, nil
+}
+
+// RevokeUserTokens invalidates every access and refresh token issued to a user until now and ends all their sessions
+func (db *DB) RevokeUserTokens(userId int) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for id, session := range dbStructure.Sessions {
+		if session.UserId == userId {
+			delete(dbStructure.Sessions, id)
+		}
+	}
+	for key, user := range dbStructure.Users {
+		if user.Id == userId {
+			user.TokensValidAfter = time.Now()
+			dbStructure.Users[key] = user
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
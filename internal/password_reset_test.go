@@ -0,0 +1,113 @@
+package Database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUsePasswordResetOnce(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	if _, err := db.CreatePasswordReset(user.Id, "hash", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if userId, err := db.FindPasswordReset("hash"); userId != user.Id || err != nil {
+		t.Errorf("FindPasswordReset = %d, %v, want %d, nil", userId, err, user.Id)
+	}
+	if userId, err := db.UsePasswordReset("hash"); userId != user.Id || err != nil {
+		t.Fatalf("UsePasswordReset = %d, %v, want %d, nil", userId, err, user.Id)
+	}
+	if _, err := db.UsePasswordReset("hash"); !errors.Is(err, ErrResetInvalid) {
+		t.Errorf("UsePasswordReset twice = %v, want %v", err, ErrResetInvalid)
+	}
+	if _, err := db.FindPasswordReset("hash"); !errors.Is(err, ErrResetInvalid) {
+		t.Errorf("FindPasswordReset of a used reset = %v, want %v", err, ErrResetInvalid)
+	}
+}
+
+func TestUsePasswordResetConsumesOthers(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	other := newTestUser(t, db, "b@example.com")
+	expiresAt := time.Now().Add(time.Hour)
+	for _, reset := range []struct {
+		userId int
+		hash   string
+	}{{user.Id, "first"}, {user.Id, "second"}, {other.Id, "other"}} {
+		if _, err := db.CreatePasswordReset(reset.userId, reset.hash, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.UsePasswordReset("second"); err != nil {
+		t.Fatal(err)
+	}
+	// An older email of the same user can't change the password again
+	if _, err := db.UsePasswordReset("first"); !errors.Is(err, ErrResetInvalid) {
+		t.Errorf("UsePasswordReset of an older reset = %v, want %v", err, ErrResetInvalid)
+	}
+	if userId, err := db.UsePasswordReset("other"); userId != other.Id || err != nil {
+		t.Errorf("UsePasswordReset of another user = %d, %v, want %d, nil", userId, err, other.Id)
+	}
+}
+
+func TestUsePasswordResetInvalid(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	if _, err := db.CreatePasswordReset(user.Id, "expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"expired", "expired"},
+		{"unknown", "unknown"},
+		{"empty", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := db.FindPasswordReset(test.hash); !errors.Is(err, ErrResetInvalid) {
+				t.Errorf("FindPasswordReset = %v, want %v", err, ErrResetInvalid)
+			}
+			if _, err := db.UsePasswordReset(test.hash); !errors.Is(err, ErrResetInvalid) {
+				t.Errorf("UsePasswordReset = %v, want %v", err, ErrResetInvalid)
+			}
+		})
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	other := newTestUser(t, db, "b@example.com")
+	for _, userId := range []int{user.Id, user.Id, other.Id} {
+		if _, err := db.CreateSession(userId, "test", "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := time.Now()
+	if err := db.RevokeUserTokens(user.Id); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := db.GetUser(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.TokensValidAfter.Before(before) {
+		t.Errorf("TokensValidAfter = %s, want at least %s", revoked.TokensValidAfter, before)
+	}
+	if sessions, err := db.GetSessions(user.Id); len(sessions) != 0 || err != nil {
+		t.Errorf("GetSessions after revoking = %d sessions, %v, want none", len(sessions), err)
+	}
+	if sessions, err := db.GetSessions(other.Id); len(sessions) != 1 || err != nil {
+		t.Errorf("GetSessions of another user = %d sessions, %v, want 1", len(sessions), err)
+	}
+	if err := db.RevokeUserTokens(100); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("RevokeUserTokens of an unknown user = %v, want %v", err, ErrUserNotFound)
+	}
+}
@@ -0,0 +1,83 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachedList holds SHA-1 hashes of breached passwords, bucketed by the first five hex
+// characters like the k-anonymity range API of Have I Been Pwned. A lookup only ever
+// touches the bucket of one prefix, so the list can be swapped for a remote range
+// query without sending the full hash anywhere
+type BreachedList struct {
+	buckets map[string]map[string]struct{}
+}
+
+// LoadBreachedList reads a file with one uppercase or lowercase SHA-1 hash per line,
+// optionally followed by ":count" as in the downloadable Have I Been Pwned lists
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{buckets: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		list.add(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *BreachedList) add(hash string) {
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+	bucket, ok := l.buckets[prefix]
+	if !ok {
+		bucket = make(map[string]struct{})
+		l.buckets[prefix] = bucket
+	}
+	bucket[suffix] = struct{}{}
+}
+
+// Range returns the hash suffixes stored under a five character prefix
+func (l *BreachedList) Range(prefix string) []string {
+	bucket := l.buckets[strings.ToUpper(prefix)]
+	suffixes := make([]string, 0, len(bucket))
+	for suffix := range bucket {
+		suffixes = append(suffixes, suffix)
+	}
+	return suffixes
+}
+
+// Contains reports whether password is on the list
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	for _, suffix := range l.Range(hash[:prefixLength]) {
+		if suffix == hash[prefixLength:] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package passwords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testArgon2id keeps the tests fast, the parameters don't matter for correctness
+var testArgon2id = Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+func TestHashVerify(t *testing.T) {
+	hashers := []struct {
+		name   string
+		hasher Hasher
+		prefix string
+	}{
+		{"bcrypt", Bcrypt{Cost: 4}, "$2a$04$"},
+		{"argon2id", testArgon2id, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+	for _, test := range hashers {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := test.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(hash, test.prefix) {
+				t.Errorf("Hash = %s, want prefix %s", hash, test.prefix)
+			}
+			if ok, err := Verify(hash, "correct horse"); !ok || err != nil {
+				t.Errorf("Verify with the password = %v, %v, want true, nil", ok, err)
+			}
+			if ok, err := Verify(hash, "wrong horse"); ok || err != nil {
+				t.Errorf("Verify with another password = %v, %v, want false, nil", ok, err)
+			}
+			if !test.hasher.Current(hash) {
+				t.Error("Current is false for a hash of the same hasher")
+			}
+			other, err := test.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other == hash {
+				t.Error("Hash gave the same hash twice, the salt isn't random")
+			}
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: 4}.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := testArgon2id.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := func(change func(a *Argon2id)) Argon2id {
+		a := testArgon2id
+		change(&a)
+		return a
+	}
+	tests := []struct {
+		name   string
+		hasher Hasher
+		hash   string
+		want   bool
+	}{
+		{"bcrypt same cost", Bcrypt{Cost: 4}, bcryptHash, true},
+		{"bcrypt higher cost", Bcrypt{Cost: 5}, bcryptHash, false},
+		{"bcrypt hash for argon2id", testArgon2id, bcryptHash, false},
+		{"argon2id same parameters", testArgon2id, argonHash, true},
+		{"argon2id more memory", changed(func(a *Argon2id) { a.Memory = 128 }), argonHash, false},
+		{"argon2id more passes", changed(func(a *Argon2id) { a.Time = 2 }), argonHash, false},
+		{"argon2id more threads", changed(func(a *Argon2id) { a.Threads = 2 }), argonHash, false},
+		{"argon2id longer key", changed(func(a *Argon2id) { a.KeyLen = 64 }), argonHash, false},
+		{"argon2id longer salt", changed(func(a *Argon2id) { a.SaltLen = 32 }), argonHash, false},
+		{"argon2id hash for bcrypt", Bcrypt{Cost: 4}, argonHash, false},
+		{"malformed argon2id", testArgon2id, "$argon2id$v=19$m=64,t=1,p=1$salt", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.Current(test.hash); got != test.want {
+				t.Errorf("Current = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	// "c2FsdHNhbHQ" is "saltsalt" and "a2V5" is "key"
+	params, salt, key, err := decodeArgon2id("$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Memory != 19456 || params.Time != 2 || params.Threads != 1 {
+		t.Errorf("parameters = m=%d,t=%d,p=%d, want m=19456,t=2,p=1", params.Memory, params.Time, params.Threads)
+	}
+	if string(salt) != "saltsalt" || string(key) != "key" {
+		t.Errorf("salt, key = %q, %q, want saltsalt, key", salt, key)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"plain text", "password"},
+		{"unknown algorithm", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5"},
+		{"missing key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA"},
+		{"extra field", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5$"},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$"},
+		{"other version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5"},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5"},
+		{"bad key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := Verify(test.hash, "password")
+			if ok || !errors.Is(err, ErrUnknownHash) {
+				t.Errorf("Verify = %v, %v, want false, %v", ok, err, ErrUnknownHash)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformedBcrypt(t *testing.T) {
+	ok, err := Verify("$2a$04$tooshort", "password")
+	if ok || err == nil {
+		t.Errorf("Verify = %v, %v, want false and an error", ok, err)
+	}
+}
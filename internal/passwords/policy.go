@@ -0,0 +1,118 @@
+// Package passwords decides which passwords users may choose
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Character classes a policy can require
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Policy lists what a password has to satisfy
+type Policy struct {
+	MinLength       int
+	MaxLength       int
+	RequiredClasses []string
+	// Breached is checked when set, passwords found in it are refused
+	Breached *BreachedList
+}
+
+// DefaultPolicy asks for a length only, composition rules are opt-in
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 8, MaxLength: 72}
+}
+
+// ParseClasses reads a comma separated list of character classes
+func ParseClasses(value string) ([]string, error) {
+	var classes []string
+	for _, class := range strings.Split(value, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if class == "" {
+			continue
+		}
+		switch class {
+		case ClassLower, ClassUpper, ClassDigit, ClassSymbol:
+			classes = append(classes, class)
+		default:
+			return nil, fmt.Errorf("unknown character class %q", class)
+		}
+	}
+	return classes, nil
+}
+
+// Check returns every rule password breaks for the account with the given email
+func (p Policy) Check(password, email string) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{Rule: "min_length", Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength)})
+	}
+	// Bcrypt ignores everything past 72 bytes, so the maximum is counted in bytes
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{Rule: "max_length", Message: fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength)})
+	}
+
+	for _, class := range p.RequiredClasses {
+		if !hasClass(password, class) {
+			violations = append(violations, Violation{Rule: "character_class", Message: "Password must contain a " + classNames[class]})
+		}
+	}
+
+	if email != "" {
+		lowered := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+		if lowered == strings.ToLower(email) || lowered == localPart {
+			violations = append(violations, Violation{Rule: "not_email", Message: "Password must not be your email"})
+		}
+	}
+
+	if p.Breached != nil && password != "" && p.Breached.Contains(password) {
+		violations = append(violations, Violation{Rule: "breached", Message: "Password appears in a known data breach, choose another one"})
+	}
+	return violations
+}
+
+var classNames = map[string]string{
+	ClassLower:  "lowercase letter",
+	ClassUpper:  "uppercase letter",
+	ClassDigit:  "digit",
+	ClassSymbol: "symbol",
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch class {
+		case ClassLower:
+			if unicode.IsLower(r) {
+				return true
+			}
+		case ClassUpper:
+			if unicode.IsUpper(r) {
+				return true
+			}
+		case ClassDigit:
+			if unicode.IsDigit(r) {
+				return true
+			}
+		case ClassSymbol:
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package Database
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrHandleTaken = errors.New("Handle already taken")
+
+// ProfileUpdate holds the public profile fields to change, nil fields are left as they are
+type ProfileUpdate struct {
+	Handle      *string
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+}
+
+// AccountUpdate holds the account fields a user changes at once, nil fields are left as they are
+type AccountUpdate struct {
+	// PendingEmail waits for confirmation from the new inbox, see ConfirmEmailChange
+	PendingEmail *string
+	Password     *string
+	Profile      ProfileUpdate
+}
+
+// UpdateAccount applies every field of update in one write, or none of them when the new
+// email or handle is taken. Premium status and the other fields are kept as they are
+func (db *DB) UpdateAccount(id int, update AccountUpdate) (User, error) {
+	// Hashing is slow on purpose, it is done before holding off other changes
+	var passwordHash string
+	if update.Password != nil {
+		hash, err := PasswordHasher.Hash(*update.Password)
+		if err != nil {
+			return User{}, err
+		}
+		passwordHash = hash
+	}
+
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	if update.PendingEmail != nil && dbStructure.emailTaken(*update.PendingEmail, id) {
+		return User{}, ErrEmailTaken
+	}
+	if update.Profile.Handle != nil && dbStructure.handleTaken(*update.Profile.Handle, id) {
+		return User{}, ErrHandleTaken
+	}
+	user, err := dbStructure.modifyUser(id, func(user *User) error {
+		if update.PendingEmail != nil {
+			user.PendingEmail = *update.PendingEmail
+		}
+		if update.Password != nil {
+			user.Password = passwordHash
+		}
+		update.Profile.apply(user)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	db.writeDB(dbStructure)
+	return user, nil
+}
+
+// apply copies the changed profile fields to user
+func (update ProfileUpdate) apply(user *User) {
+	if update.Handle != nil {
+		user.Handle = *update.Handle
+	}
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+	if update.AvatarURL != nil {
+		user.AvatarURL = *update.AvatarURL
+	}
+}
+
+// handleTaken tells whether a user other than id has handle, ignoring case
+func (dbStructure *DBStructure) handleTaken(handle string, id int) bool {
+	for _, user := range dbStructure.Users {
+		if user.Id != id && user.Handle != "" && strings.EqualFold(user.Handle, handle) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserByHandle finds a user by handle ignoring case
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for _, user := range dbStructure.Users {
+		if user.Handle != "" && strings.EqualFold(user.Handle, handle) {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+// ProfileCounts are the numbers shown on a public profile
+type ProfileCounts struct {
+	Chirps    int
+	Followers int
+	Following int
+}
+
+func (db *DB) GetProfileCounts(id int) (ProfileCounts, error) {
+	var counts ProfileCounts
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return counts, err
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorId == id && chirp.isVisible() {
+			counts.Chirps++
+		}
+	}
+	for _, follow := range dbStructure.Follows {
+		if follow.FolloweeId == id {
+			counts.Followers++
+		}
+		if follow.FollowerId == id {
+			counts.Following++
+		}
+	}
+	return counts, nil
+}
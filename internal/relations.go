@@ -0,0 +1,134 @@
+package Database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	RelationBlock = "block"
+	RelationMute  = "mute"
+)
+
+var (
+	ErrRelationExists   = errors.New("Relation already exists")
+	ErrRelationNotFound = errors.New("Relation not found")
+	ErrBlocked          = errors.New("Blocked by this user")
+)
+
+// Relation is a block or a mute of TargetId by UserId
+type Relation struct {
+	Id        int
+	UserId    int
+	TargetId  int
+	Kind      string
+	CreatedAt time.Time
+}
+
+// AddRelation blocks or mutes a user. Blocking also drops the follows between both users
+func (db *DB) AddRelation(userId, targetId int, kind string) (Relation, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Relation{}, err
+	}
+	if dbStructure.Relations == nil {
+		dbStructure.Relations = make(map[int]Relation)
+	}
+	nextId := 1
+	for _, relation := range dbStructure.Relations {
+		if relation.UserId == userId && relation.TargetId == targetId && relation.Kind == kind {
+			return relation, ErrRelationExists
+		}
+		if relation.Id >= nextId {
+			nextId = relation.Id + 1
+		}
+	}
+	relation := Relation{Id: nextId, UserId: userId, TargetId: targetId, Kind: kind, CreatedAt: time.Now()}
+	dbStructure.Relations[relation.Id] = relation
+	if kind == RelationBlock {
+		for key, follow := range dbStructure.Follows {
+			if (follow.FollowerId == userId && follow.FolloweeId == targetId) || (follow.FollowerId == targetId && follow.FolloweeId == userId) {
+				delete(dbStructure.Follows, key)
+			}
+		}
+	}
+	db.writeDB(dbStructure)
+	return relation, nil
+}
+
+func (db *DB) RemoveRelation(userId, targetId int, kind string) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, relation := range dbStructure.Relations {
+		if relation.UserId == userId && relation.TargetId == targetId && relation.Kind == kind {
+			delete(dbStructure.Relations, key)
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrRelationNotFound
+}
+
+// GetRelations returns the users blocked or muted by userId, newest first
+func (db *DB) GetRelations(userId int, kind string) ([]Relation, error) {
+	var relations []Relation
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return relations, err
+	}
+	for _, relation := range dbStructure.Relations {
+		if relation.UserId == userId && relation.Kind == kind {
+			relations = append(relations, relation)
+		}
+	}
+	sort.Slice(relations, func(i, j int) bool {
+		return relations[i].Id > relations[j].Id
+	})
+	return relations, nil
+}
+
+// IsBlockedBy reports whether blockerId blocked userId
+func (db *DB) IsBlockedBy(blockerId, userId int) (bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+	return dbStructure.isBlockedBy(blockerId, userId), nil
+}
+
+// GetExcludedAuthors returns the authors whose chirps userId shouldn't see: the users they
+// blocked and, when includeMuted is set for timelines and feeds, the users they muted
+func (db *DB) GetExcludedAuthors(userId int, includeMuted bool) (map[int]bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return dbStructure.excludedAuthors(userId, includeMuted), nil
+}
+
+func (dbStructure DBStructure) isBlockedBy(blockerId, userId int) bool {
+	for _, relation := range dbStructure.Relations {
+		if relation.UserId == blockerId && relation.TargetId == userId && relation.Kind == RelationBlock {
+			return true
+		}
+	}
+	return false
+}
+
+func (dbStructure DBStructure) excludedAuthors(userId int, includeMuted bool) map[int]bool {
+	excluded := make(map[int]bool)
+	for _, relation := range dbStructure.Relations {
+		if relation.UserId != userId {
+			continue
+		}
+		if relation.Kind == RelationBlock || (includeMuted && relation.Kind == RelationMute) {
+			excluded[relation.TargetId] = true
+		}
+	}
+	return excluded
+}
@@ -0,0 +1,139 @@
+package Database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlockDropsFollows(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	target := newTestUser(t, db, "b@example.com")
+	if _, err := db.FollowUser(user.Id, target.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FollowUser(target.Id, user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.AddRelation(user.Id, target.Id, RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{user.Id, target.Id} {
+		if following, err := db.GetFollowing(id); len(following) != 0 || err != nil {
+			t.Errorf("GetFollowing(%d) after a block = %d follows, %v, want none", id, len(following), err)
+		}
+	}
+	if _, err := db.FollowUser(target.Id, user.Id); !errors.Is(err, ErrBlocked) {
+		t.Errorf("FollowUser of the blocker = %v, want %v", err, ErrBlocked)
+	}
+	// Blocking only stops the blocked user from following
+	if _, err := db.FollowUser(user.Id, target.Id); err != nil {
+		t.Errorf("FollowUser of the blocked user = %v", err)
+	}
+}
+
+func TestMuteKeepsFollows(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	target := newTestUser(t, db, "b@example.com")
+	if _, err := db.FollowUser(user.Id, target.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddRelation(user.Id, target.Id, RelationMute); err != nil {
+		t.Fatal(err)
+	}
+	if following, err := db.GetFollowing(user.Id); len(following) != 1 || err != nil {
+		t.Errorf("GetFollowing after a mute = %d follows, %v, want 1", len(following), err)
+	}
+	if blocked, err := db.IsBlockedBy(user.Id, target.Id); blocked || err != nil {
+		t.Errorf("IsBlockedBy after a mute = %v, %v, want false", blocked, err)
+	}
+}
+
+func TestGetExcludedAuthors(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	blocked := newTestUser(t, db, "b@example.com")
+	muted := newTestUser(t, db, "c@example.com")
+	if _, err := db.AddRelation(user.Id, blocked.Id, RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddRelation(user.Id, muted.Id, RelationMute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddRelation(user.Id, muted.Id, RelationMute); !errors.Is(err, ErrRelationExists) {
+		t.Errorf("AddRelation twice = %v, want %v", err, ErrRelationExists)
+	}
+
+	tests := []struct {
+		name         string
+		userId       int
+		includeMuted bool
+		want         map[int]bool
+	}{
+		{"blocks only", user.Id, false, map[int]bool{blocked.Id: true}},
+		{"blocks and mutes", user.Id, true, map[int]bool{blocked.Id: true, muted.Id: true}},
+		// A block hides the blocker from nobody, it only filters what the blocker sees
+		{"blocked user", blocked.Id, true, map[int]bool{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			excluded, err := db.GetExcludedAuthors(test.userId, test.includeMuted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(excluded) != len(test.want) {
+				t.Fatalf("GetExcludedAuthors = %v, want %v", excluded, test.want)
+			}
+			for id := range test.want {
+				if !excluded[id] {
+					t.Errorf("GetExcludedAuthors = %v, want %v", excluded, test.want)
+				}
+			}
+		})
+	}
+
+	if err := db.RemoveRelation(user.Id, blocked.Id, RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if excluded, _ := db.GetExcludedAuthors(user.Id, false); excluded[blocked.Id] {
+		t.Error("GetExcludedAuthors still excludes an unblocked user")
+	}
+	if err := db.RemoveRelation(user.Id, blocked.Id, RelationBlock); !errors.Is(err, ErrRelationNotFound) {
+		t.Errorf("RemoveRelation twice = %v, want %v", err, ErrRelationNotFound)
+	}
+}
+
+func TestTimelineExcludesBlockedAndMuted(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	followed := newTestUser(t, db, "b@example.com")
+	muted := newTestUser(t, db, "c@example.com")
+	for _, id := range []int{followed.Id, muted.Id} {
+		if _, err := db.FollowUser(user.Id, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.CreateChirp(Chirp{Body: "hello", AuthorId: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.AddRelation(user.Id, muted.Id, RelationMute); err != nil {
+		t.Fatal(err)
+	}
+
+	chirps, err := db.GetTimeline(user.Id, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 1 || chirps[0].AuthorId != followed.Id {
+		t.Fatalf("GetTimeline with a muted followee = %v, want only the chirp of %d", chirps, followed.Id)
+	}
+
+	if _, err := db.AddRelation(user.Id, followed.Id, RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if chirps, err := db.GetTimeline(user.Id, 0, 10); len(chirps) != 0 || err != nil {
+		t.Errorf("GetTimeline after blocking the last followee = %v, %v, want no chirps", chirps, err)
+	}
+}
@@ -0,0 +1,114 @@
+package Database
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReportOpen     = "open"
+	ReportResolved = "resolved"
+)
+
+var ErrDuplicateReport = errors.New("Target already reported by this user")
+
+// Report is a user flagging a chirp or, when ChirpId is 0, another user's account
+type Report struct {
+	Id         int
+	ReporterId int
+	ChirpId    int
+	UserId     int
+	Category   string
+	Text       string
+	Status     string
+	CreatedAt  time.Time
+}
+
+// CreateReport stores a report unless the reporter already reported the same target.
+// It returns the number of distinct reporters with an open report on that target
+func (db *DB) CreateReport(report Report) (Report, int, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return report, 0, err
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = make(map[int]Report)
+	}
+	reporters := make(map[int]bool)
+	for _, existing := range dbStructure.Reports {
+		if existing.ChirpId != report.ChirpId || existing.UserId != report.UserId {
+			continue
+		}
+		if existing.ReporterId == report.ReporterId {
+			return report, 0, ErrDuplicateReport
+		}
+		if existing.Status == ReportOpen {
+			reporters[existing.ReporterId] = true
+		}
+	}
+	nextId := 1
+	for _, existing := range dbStructure.Reports {
+		if existing.Id >= nextId {
+			nextId = existing.Id + 1
+		}
+	}
+	report.Id = nextId
+	report.Status = ReportOpen
+	report.CreatedAt = time.Now()
+	dbStructure.Reports[report.Id] = report
+	reporters[report.ReporterId] = true
+	db.writeDB(dbStructure)
+	return report, len(reporters), nil
+}
+
+// GetReports returns the open reports on a chirp, or on a user when chirpId is 0
+func (db *DB) GetReports(chirpId, userId int) ([]Report, error) {
+	var reports []Report
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return reports, err
+	}
+	for _, report := range dbStructure.Reports {
+		if report.ChirpId == chirpId && report.UserId == userId && report.Status == ReportOpen {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+// HideChirp takes a published chirp out of the reads until a moderator reviews it
+func (db *DB) HideChirp(id int) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, chirp := range dbStructure.Chirps {
+		if chirp.Id == id {
+			chirp.Status = ChirpHeld
+			dbStructure.Chirps[key] = chirp
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrChirpNotFound
+}
+
+// SetUserHidden hides or shows again every chirp of a user
+func (db *DB) SetUserHidden(id int, hidden bool) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, user := range dbStructure.Users {
+		if user.Id == id {
+			user.Hidden = hidden
+			dbStructure.Users[key] = user
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
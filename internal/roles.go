@@ -0,0 +1,45 @@
+package Database
+
+import "errors"
+
+// Roles, each one can do everything the roles before it can
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var ErrUnknownRole = errors.New("Unknown role")
+
+var roleRanks = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants everything minimum does. Users created before
+// roles existed have no role and count as RoleUser
+func RoleAtLeast(role, minimum string) bool {
+	if role == "" {
+		role = RoleUser
+	}
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[minimum]
+}
+
+// SetRole changes the role of a user
+func (db *DB) SetRole(id int, role string) (User, error) {
+	if !ValidRole(role) {
+		return User{}, ErrUnknownRole
+	}
+	return db.updateUser(id, func(user *User) error {
+		user.Role = role
+		return nil
+	})
+}
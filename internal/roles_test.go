@@ -0,0 +1,46 @@
+package Database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role    string
+		minimum string
+		want    bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleUser, RoleAdmin, false},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		// Users from before roles existed
+		{"", RoleUser, true},
+		{"", RoleModerator, false},
+		{"superuser", RoleUser, false},
+	}
+	for _, test := range tests {
+		if got := RoleAtLeast(test.role, test.minimum); got != test.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", test.role, test.minimum, got, test.want)
+		}
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	if updated, err := db.SetRole(user.Id, RoleModerator); updated.Role != RoleModerator || err != nil {
+		t.Errorf("SetRole = %q, %v, want %q", updated.Role, err, RoleModerator)
+	}
+	if _, err := db.SetRole(user.Id, "superuser"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("SetRole with an unknown role = %v, want %v", err, ErrUnknownRole)
+	}
+	if stored, err := db.GetUser(user.Id); stored.Role != RoleModerator || err != nil {
+		t.Errorf("role after an unknown role = %q, %v, want %q", stored.Role, err, RoleModerator)
+	}
+}
@@ -0,0 +1,142 @@
+package Database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrSessionNotFound = errors.New("Session not found")
+	ErrTokenReused     = errors.New("Refresh token already used")
+	ErrTokenRevoked    = errors.New("Token already revoked")
+)
+
+// Session is one login of a user on a device. Its refresh tokens form a family: each refresh
+// replaces the token with the next generation, and only the latest generation is valid
+type Session struct {
+	Id         int
+	UserId     int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	Generation int
+}
+
+func (db *DB) CreateSession(userId int, userAgent, ip string) (Session, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Session{}, err
+	}
+	if dbStructure.Sessions == nil {
+		dbStructure.Sessions = make(map[int]Session)
+	}
+	nextId := 1
+	for _, session := range dbStructure.Sessions {
+		if session.Id >= nextId {
+			nextId = session.Id + 1
+		}
+	}
+	now := time.Now()
+	session := Session{Id: nextId, UserId: userId, UserAgent: userAgent, IP: ip, CreatedAt: now, LastUsedAt: now}
+	dbStructure.Sessions[session.Id] = session
+	db.writeDB(dbStructure)
+	return session, nil
+}
+
+// RotateSession moves a session of userId past the refresh token of the given generation and
+// returns it with the generation of the next token. A token of an older generation means it
+// was stolen or replayed, so the whole session is revoked and ErrTokenReused returned. The
+// check and the move happen under the process-wide write lock, so of two concurrent refreshes
+// with the same token only the first gets the next generation
+func (db *DB) RotateSession(userId, id, generation int, ip string) (Session, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Session{}, err
+	}
+	session, ok := dbStructure.Sessions[id]
+	if !ok || session.UserId != userId {
+		return Session{}, ErrSessionNotFound
+	}
+	if generation != session.Generation {
+		delete(dbStructure.Sessions, id)
+		db.writeDB(dbStructure)
+		return Session{}, ErrTokenReused
+	}
+	session.Generation++
+	session.LastUsedAt = time.Now()
+	session.IP = ip
+	dbStructure.Sessions[id] = session
+	db.writeDB(dbStructure)
+	return session, nil
+}
+
+// GetSession returns one session of a user
+func (db *DB) GetSession(userId, id int) (Session, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Session{}, err
+	}
+	session, ok := dbStructure.Sessions[id]
+	if !ok || session.UserId != userId {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// GetSessions returns the sessions of a user, most recently used first
+func (db *DB) GetSessions(userId int) ([]Session, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	for _, session := range dbStructure.Sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession ends one session of a user
+func (db *DB) RevokeSession(userId, id int) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	session, ok := dbStructure.Sessions[id]
+	if !ok || session.UserId != userId {
+		return ErrSessionNotFound
+	}
+	delete(dbStructure.Sessions, id)
+	db.writeDB(dbStructure)
+	return nil
+}
+
+// PurgeSessions removes sessions that weren't used for longer than idle, it returns how many
+func (db *DB) PurgeSessions(idle time.Duration) (int, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for id, session := range dbStructure.Sessions {
+		if time.Since(session.LastUsedAt) > idle {
+			delete(dbStructure.Sessions, id)
+			purged++
+		}
+	}
+	if purged > 0 {
+		db.writeDB(dbStructure)
+	}
+	return purged, nil
+}
@@ -0,0 +1,116 @@
+package Database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRotateSession(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	session, err := db.CreateSession(user.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := db.RotateSession(user.Id, session.Id, session.Generation, "127.0.0.2")
+	if err != nil {
+		t.Fatalf("RotateSession with the current generation: %s", err)
+	}
+	if rotated.Generation != session.Generation+1 || rotated.IP != "127.0.0.2" {
+		t.Errorf("RotateSession = generation %d from %s, want generation %d from 127.0.0.2", rotated.Generation, rotated.IP, session.Generation+1)
+	}
+	rotated, err = db.RotateSession(user.Id, session.Id, rotated.Generation, "127.0.0.2")
+	if err != nil || rotated.Generation != session.Generation+2 {
+		t.Errorf("RotateSession again = generation %d, %v, want generation %d", rotated.Generation, err, session.Generation+2)
+	}
+}
+
+func TestRotateSessionReuse(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	session, err := db.CreateSession(user.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RotateSession(user.Id, session.Id, session.Generation, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first token was already exchanged, using it again means it leaked
+	_, err = db.RotateSession(user.Id, session.Id, session.Generation, "")
+	if !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("RotateSession with a used generation = %v, want %v", err, ErrTokenReused)
+	}
+	if _, err := db.GetSession(user.Id, session.Id); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession after reuse = %v, want the session revoked", err)
+	}
+	// The legitimate holder of the latest token is logged out as well
+	_, err = db.RotateSession(user.Id, session.Id, session.Generation+1, "")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RotateSession with the latest generation after reuse = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestRotateSessionOtherUser(t *testing.T) {
+	db := newTestDB(t)
+	owner := newTestUser(t, db, "a@example.com")
+	other := newTestUser(t, db, "b@example.com")
+	session, err := db.CreateSession(owner.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RotateSession(other.Id, session.Id, session.Generation, ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RotateSession of another user's session = %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err := db.GetSession(owner.Id, session.Id); err != nil {
+		t.Errorf("GetSession of the owner = %v, the session must survive", err)
+	}
+}
+
+func TestRotateSessionConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "a@example.com")
+	session, err := db.CreateSession(user.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const refreshes = 10
+	var wg sync.WaitGroup
+	results := make(chan error, refreshes)
+	for i := 0; i < refreshes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.RotateSession(user.Id, session.Id, session.Generation, "")
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d concurrent refreshes with the same token succeeded, want 1", succeeded, refreshes)
+	}
+}
+
+func TestRevokeTokenOnce(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.RevokeToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeToken("token"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("RevokeToken twice = %v, want %v", err, ErrTokenRevoked)
+	}
+	if err := db.RevokeToken("other"); err != nil {
+		t.Errorf("RevokeToken of another token = %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8 digit codes, a 6 digit code is their last 6 digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := Code(rfcSecret, Counter(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %s", vector.unix, err)
+		}
+		if code != vector.code {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	code, err := Code(strings.ToLower(rfcSecret), Counter(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Errorf("Code with lowercase secret = %q, %v, want 287082", code, err)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted a secret that isn't base32")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := Counter(now)
+	codeAt := func(counter int64) string {
+		code, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name        string
+		code        string
+		wantCounter int64
+		wantOk      bool
+	}{
+		{"current step", codeAt(counter), counter, true},
+		{"previous step", codeAt(counter - 1), counter - 1, true},
+		{"next step", codeAt(counter + 1), counter + 1, true},
+		{"outside the window before", codeAt(counter - 2), 0, false},
+		{"outside the window after", codeAt(counter + 2), 0, false},
+		{"with spaces", codeAt(counter)[:3] + " " + codeAt(counter)[3:], counter, true},
+		{"too short", codeAt(counter)[:5], 0, false},
+		{"too long", codeAt(counter) + "0", 0, false},
+		{"empty", "", 0, false},
+		{"not digits", "abcdef", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotCounter, gotOk := Validate(rfcSecret, test.code, now)
+			if gotOk != test.wantOk || gotCounter != test.wantCounter {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", test.code, gotCounter, gotOk, test.wantCounter, test.wantOk)
+			}
+		})
+	}
+}
+
+// Callers refuse a code whose time step isn't after the last one used, so the counter a code
+// validates with has to be the same however often it is sent within the window
+func TestValidateReplayCounter(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Counter(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("Validate refused the current code")
+	}
+	again, ok := Validate(rfcSecret, code, issued.Add(Period*time.Second))
+	if !ok || again != first {
+		t.Errorf("Validate a step later = %d, %v, want %d, true", again, ok, first)
+	}
+	if next, _ := Validate(rfcSecret, code, issued.Add(2*Period*time.Second)); next != 0 {
+		t.Errorf("Validate two steps later matched step %d", next)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateSecret = %q, want 20 base32 encoded bytes", secret)
+	}
+	other, _ := GenerateSecret()
+	if other == secret {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Chirpy", "a@example.com", rfcSecret)
+	want := "otpauth://totp/Chirpy:a@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=" + rfcSecret
+	if uri != want {
+		t.Errorf("ProvisioningURI = %s, want %s", uri, want)
+	}
+}
@@ -0,0 +1,70 @@
+package Database
+
+import "errors"
+
+var (
+	ErrTOTPNotPending = errors.New("No two-factor enrollment in progress")
+	ErrCodeReused     = errors.New("Code already used")
+	ErrRecoveryCode   = errors.New("Unknown recovery code")
+)
+
+// SetPendingTOTP stores a secret that becomes active once the user confirms it with a code
+func (db *DB) SetPendingTOTP(id int, secret string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.TOTPPendingSecret = secret
+		return nil
+	})
+}
+
+// EnableTOTP activates the pending secret, replacing the recovery codes with the given hashes
+func (db *DB) EnableTOTP(id int, counter int64, recoveryHashes []string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		if user.TOTPPendingSecret == "" {
+			return ErrTOTPNotPending
+		}
+		user.TOTPSecret = user.TOTPPendingSecret
+		user.TOTPPendingSecret = ""
+		user.TOTPEnabled = true
+		user.TOTPLastCounter = counter
+		user.RecoveryCodes = recoveryHashes
+		return nil
+	})
+}
+
+// DisableTOTP turns two-factor authentication off and forgets the secret and recovery codes
+func (db *DB) DisableTOTP(id int) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.TOTPSecret = ""
+		user.TOTPPendingSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastCounter = 0
+		user.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// UseTOTPCounter records the time step of an accepted code, so the same code can't be replayed
+func (db *DB) UseTOTPCounter(id int, counter int64) error {
+	_, err := db.updateUser(id, func(user *User) error {
+		if counter <= user.TOTPLastCounter {
+			return ErrCodeReused
+		}
+		user.TOTPLastCounter = counter
+		return nil
+	})
+	return err
+}
+
+// UseRecoveryCode removes the recovery code with the given hash, each one works once
+func (db *DB) UseRecoveryCode(id int, hash string) error {
+	_, err := db.updateUser(id, func(user *User) error {
+		for i, code := range user.RecoveryCodes {
+			if code == hash {
+				user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+		return ErrRecoveryCode
+	})
+	return err
+}
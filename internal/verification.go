@@ -0,0 +1,103 @@
+package Database
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEmailChanged = errors.New("Email changed since the link was sent")
+	ErrEmailTaken   = errors.New("Email already taken")
+)
+
+// emailTaken reports whether another user than exceptId has email, ignoring case
+func (dbStructure DBStructure) emailTaken(email string, exceptId int) bool {
+	for _, user := range dbStructure.Users {
+		if user.Id != exceptId && !user.Deleted && !user.Anonymous && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserByEmail looks a user up by email, ignoring case
+func (db *DB) GetUserByEmail(email string) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for _, user := range dbStructure.Users {
+		if !user.Deleted && !user.Anonymous && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+// ConfirmEmailChange switches a user to their pending email if it is still the one in the link
+func (db *DB) ConfirmEmailChange(id int, email string) (User, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	// The email may have been taken by a signup since the change was requested
+	if dbStructure.emailTaken(email, id) {
+		return User{}, ErrEmailTaken
+	}
+	user, err := dbStructure.modifyUser(id, func(user *User) error {
+		if user.PendingEmail == "" || user.PendingEmail != email {
+			return ErrEmailChanged
+		}
+		user.Email = email
+		user.PendingEmail = ""
+		user.Verified = true
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	db.writeDB(dbStructure)
+	return user, nil
+}
+
+// VerifyUser marks a user as verified if email is still their email
+func (db *DB) VerifyUser(id int, email string) (User, error) {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for key, user := range dbStructure.Users {
+		if user.Id != id {
+			continue
+		}
+		if user.Email != email {
+			return User{}, ErrEmailChanged
+		}
+		user.Verified = true
+		dbStructure.Users[key] = user
+		db.writeDB(dbStructure)
+		return user, nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+// SetVerificationSent records when the last verification email was sent to a user
+func (db *DB) SetVerificationSent(id int, sentAt time.Time) error {
+	defer db.lockWrites()()
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	for key, user := range dbStructure.Users {
+		if user.Id == id {
+			user.VerificationSentAt = sentAt
+			dbStructure.Users[key] = user
+			db.writeDB(dbStructure)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp id")
+		return
+	}
+	chirp, err := db.GetChirp(userId, chirpId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	_, err = db.LikeChirp(userId, chirpId)
+	if errors.Is(err, Database.ErrAlreadyLiked) {
+		respondWithError(w, http.StatusConflict, "You already liked this chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp")
+		return
+	}
+
+	notify(db, Database.Notification{
+		UserId:  chirp.AuthorId,
+		ActorId: userId,
+		Type:    Database.NotificationLike,
+		ChirpId: chirp.Id,
+		Message: actorName(db, userId) + " liked your chirp",
+	})
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+func unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	chirpId, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp id")
+		return
+	}
+
+	err = db.UnlikeChirp(userId, chirpId)
+	if errors.Is(err, Database.ErrNotLiked) {
+		respondWithError(w, http.StatusNotFound, "You didn't like this chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
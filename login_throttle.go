@@ -0,0 +1,195 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// loginThrottle counts login attempts that didn't succeed per key, an email or an IP
+// address. After a few free attempts every failure doubles the wait before the next attempt,
+// and past the lockout threshold the key is locked out entirely for a while
+type loginThrottle struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+
+	freeAttempts     int
+	lockoutThreshold int
+	baseDelay        time.Duration
+	maxDelay         time.Duration
+	lockoutDuration  time.Duration
+}
+
+type loginAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+func newLoginThrottle(freeAttempts, lockoutThreshold int, lockoutDuration time.Duration) *loginThrottle {
+	return &loginThrottle{
+		attempts:         make(map[string]*loginAttempts),
+		freeAttempts:     freeAttempts,
+		lockoutThreshold: lockoutThreshold,
+		baseDelay:        time.Second,
+		maxDelay:         lockoutDuration,
+		lockoutDuration:  lockoutDuration,
+	}
+}
+
+// Attempt returns how long key has to wait before it may try again. When it may try now the
+// attempt is counted as a failure right away, in the same lock as the check, so a burst of
+// parallel attempts can't all slip through before the first one fails. An attempt that turns
+// out well is given back with Release
+func (t *loginThrottle) Attempt(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	attempts, ok := t.attempts[key]
+	if ok {
+		if wait := attempts.blockedUntil.Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	// Failures are forgotten once a key stayed quiet for a whole lockout period
+	if !ok || now.Sub(attempts.lastFailure) > t.lockoutDuration {
+		attempts = &loginAttempts{}
+		t.attempts[key] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	t.block(attempts)
+	return 0
+}
+
+// Release takes back an attempt of key that succeeded
+func (t *loginThrottle) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	attempts, ok := t.attempts[key]
+	if !ok {
+		return
+	}
+	attempts.failures--
+	if attempts.failures <= 0 {
+		delete(t.attempts, key)
+		return
+	}
+	t.block(attempts)
+}
+
+// block sets how long a key waits after its last failure, t.mu must be held
+func (t *loginThrottle) block(attempts *loginAttempts) {
+	switch {
+	case attempts.failures >= t.lockoutThreshold:
+		attempts.blockedUntil = attempts.lastFailure.Add(t.lockoutDuration)
+	case attempts.failures > t.freeAttempts:
+		delay := t.baseDelay * time.Duration(math.Pow(2, float64(attempts.failures-t.freeAttempts-1)))
+		if delay > t.maxDelay || delay <= 0 {
+			delay = t.maxDelay
+		}
+		attempts.blockedUntil = attempts.lastFailure.Add(delay)
+	default:
+		attempts.blockedUntil = time.Time{}
+	}
+}
+
+// Reset forgets the failures of key, after a successful login or an admin unlock
+func (t *loginThrottle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, key)
+}
+
+// purge drops keys that have been quiet for a whole lockout period, every interval
+func (t *loginThrottle) purge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.mu.Lock()
+		for key, attempts := range t.attempts {
+			if time.Since(attempts.lastFailure) > t.lockoutDuration && time.Now().After(attempts.blockedUntil) {
+				delete(t.attempts, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// accountKey is the throttle key of an email, so casing doesn't buy extra attempts
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkLoginThrottle answers 429 with a Retry-After header if the account or the IP has to
+// wait. Otherwise the attempt already counts as failed against both until passLogin or
+// completeLogin gives it back
+func (cfg *apiConfig) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	wait := cfg.accountThrottle.Attempt(accountKey(email))
+	ipWait := cfg.ipThrottle.Attempt(clientIP(r))
+	if wait == 0 && ipWait == 0 {
+		return true
+	}
+	// Only the key that let the attempt through counted it
+	if wait == 0 {
+		cfg.accountThrottle.Release(accountKey(email))
+	}
+	if ipWait == 0 {
+		cfg.ipThrottle.Release(clientIP(r))
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	return false
+}
+
+// passLogin gives back an attempt whose password or code was right, earlier failures still count
+func (cfg *apiConfig) passLogin(r *http.Request, email string) {
+	cfg.accountThrottle.Release(accountKey(email))
+	cfg.ipThrottle.Release(clientIP(r))
+}
+
+// completeLogin gives back the attempt of a finished login and forgets the account's failures
+func (cfg *apiConfig) completeLogin(r *http.Request, email string) {
+	cfg.accountThrottle.Reset(accountKey(email))
+	cfg.ipThrottle.Release(clientIP(r))
+}
+
+func (cfg *apiConfig) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	userId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	user, err := db.GetUser(userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	cfg.accountThrottle.Reset(accountKey(user.Email))
+	respondWithoutJSON(w, http.StatusNoContent)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleDelays(t *testing.T) {
+	throttle := newLoginThrottle(3, 20, time.Minute)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{9, 32 * time.Second},
+		// Backoff never waits longer than a lockout
+		{10, time.Minute},
+		{19, time.Minute},
+		{20, time.Minute},
+	}
+	for _, test := range tests {
+		attempts := &loginAttempts{failures: test.failures, lastFailure: time.Now()}
+		throttle.block(attempts)
+		got := time.Duration(0)
+		if !attempts.blockedUntil.IsZero() {
+			got = attempts.blockedUntil.Sub(attempts.lastFailure)
+		}
+		if got != test.want {
+			t.Errorf("delay after %d failures = %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestLoginThrottleAttempt(t *testing.T) {
+	throttle := newLoginThrottle(3, 10, time.Minute)
+	for i := 1; i <= 4; i++ {
+		if wait := throttle.Attempt("a@example.com"); wait != 0 {
+			t.Fatalf("attempt %d waits %s, want the first 4 let through", i, wait)
+		}
+	}
+	if wait := throttle.Attempt("a@example.com"); wait <= 0 || wait > time.Second {
+		t.Errorf("attempt after the free ones waits %s, want up to 1s", wait)
+	}
+	if wait := throttle.Attempt("b@example.com"); wait != 0 {
+		t.Errorf("attempt of another key waits %s, want 0", wait)
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	throttle := newLoginThrottle(2, 4, time.Minute)
+	// Small enough to sleep through the backoff before the lockout
+	throttle.baseDelay = time.Microsecond
+	for i := 1; i <= 4; i++ {
+		if wait := throttle.Attempt("key"); wait != 0 {
+			t.Fatalf("attempt %d waits %s, want 0", i, wait)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if wait := throttle.Attempt("key"); wait < 59*time.Second || wait > time.Minute {
+		t.Errorf("attempt past the lockout threshold waits %s, want about 1m", wait)
+	}
+	throttle.Reset("key")
+	if wait := throttle.Attempt("key"); wait != 0 {
+		t.Errorf("attempt after Reset waits %s, want 0", wait)
+	}
+}
+
+func TestLoginThrottleRelease(t *testing.T) {
+	throttle := newLoginThrottle(1, 10, time.Minute)
+	throttle.Attempt("key")
+	throttle.Attempt("key")
+	// The second attempt was right, only the first failure counts
+	throttle.Release("key")
+	if wait := throttle.Attempt("key"); wait != 0 {
+		t.Errorf("attempt after Release waits %s, want 0", wait)
+	}
+	if wait := throttle.Attempt("key"); wait == 0 {
+		t.Error("attempt after two failures was let through, want a backoff")
+	}
+	throttle.Release("unknown")
+	if _, ok := throttle.attempts["unknown"]; ok {
+		t.Error("Release of an unknown key added it")
+	}
+}
+
+func TestLoginThrottleBurst(t *testing.T) {
+	throttle := newLoginThrottle(3, 10, time.Minute)
+	const burst = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if throttle.Attempt("key") == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 4 {
+		t.Errorf("%d of %d parallel attempts were let through, want the 3 free ones and one more", allowed, burst)
+	}
+}
+
+func TestCheckLoginThrottle(t *testing.T) {
+	cfg := &apiConfig{
+		accountThrottle: newLoginThrottle(1, 10, time.Minute),
+		ipThrottle:      newLoginThrottle(10, 100, time.Minute),
+	}
+	check := func(email string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		cfg.checkLoginThrottle(w, r, email)
+		return w
+	}
+
+	check("a@example.com")
+	check("a@example.com")
+	// Casing and spaces don't make it another account
+	w := check(" A@Example.com")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("throttled attempt = %d with Retry-After %q, want %d with 1", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	// The refused attempt doesn't count against the IP
+	if failures := cfg.ipThrottle.attempts["192.0.2.1"].failures; failures != 2 {
+		t.Errorf("IP failures = %d, want 2", failures)
+	}
+
+	cfg.completeLogin(httptest.NewRequest(http.MethodPost, "/api/login", nil), "a@example.com")
+	if w := check("a@example.com"); w.Code != http.StatusOK {
+		t.Errorf("attempt after completeLogin = %d, want it let through", w.Code)
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"chirpy/internal/moderation"
+	"chirpy/internal/passwords"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var ApiConfig *apiConfig
@@ -15,8 +22,105 @@ func main() {
 	const filepathRoot = "."
 	const port = "8080"
 	godotenv.Load()
+	// Token issue times are compared with the moment a user's tokens were revoked, seconds are too coarse
+	jwt.TimePrecision = time.Millisecond
 
 	ApiConfig = setUpApiConfig(0, os.Getenv("JWT_SECRET"), os.Getenv("POLKA_API_KEY"))
+	ApiConfig.adminApiKey = os.Getenv("ADMIN_API_KEY")
+	ApiConfig.reportThreshold = getEnvInt("REPORT_HIDE_THRESHOLD", 3)
+	ApiConfig.events = events.NewBus(getEnvInt("STREAM_BUFFER_SIZE", 1000), 64)
+	ApiConfig.mailer = newMailer()
+	ApiConfig.publicURL = os.Getenv("PUBLIC_URL")
+	if ApiConfig.publicURL == "" {
+		ApiConfig.publicURL = "http://localhost:" + port
+	}
+	ApiConfig.requireVerified = os.Getenv("REQUIRE_VERIFIED_TO_POST") == "true"
+	ApiConfig.verificationResendInterval = time.Duration(getEnvInt("VERIFICATION_RESEND_MINUTES", 5)) * time.Minute
+	ApiConfig.trashRetention = time.Duration(getEnvInt("CHIRP_TRASH_RETENTION_HOURS", 24*30)) * time.Hour
+	go ApiConfig.purgeTrash(time.Hour)
+	go purgeSessions(time.Hour)
+
+	ApiConfig.deletedChirps = os.Getenv("ACCOUNT_DELETION_CHIRPS")
+	if ApiConfig.deletedChirps == "" {
+		ApiConfig.deletedChirps = Database.DeletedChirpsDelete
+	}
+	if ApiConfig.deletedChirps != Database.DeletedChirpsDelete && ApiConfig.deletedChirps != Database.DeletedChirpsReassign {
+		log.Fatalf("Unknown ACCOUNT_DELETION_CHIRPS %q, use delete or reassign", ApiConfig.deletedChirps)
+	}
+
+	lockoutDuration := time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+	ApiConfig.accountThrottle = newLoginThrottle(3, getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10), lockoutDuration)
+	ApiConfig.ipThrottle = newLoginThrottle(10, getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100), lockoutDuration)
+	go ApiConfig.accountThrottle.purge(time.Minute)
+	go ApiConfig.ipThrottle.purge(time.Minute)
+
+	ApiConfig.passwordPolicy = passwords.DefaultPolicy()
+	switch hasher := os.Getenv("PASSWORD_HASHER"); hasher {
+	case "", "bcrypt":
+		// bcrypt quietly uses its default for costs out of range, no hash would ever be current
+		cost := getEnvInt("BCRYPT_COST", 10)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			log.Fatalf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		Database.PasswordHasher = passwords.Bcrypt{Cost: cost}
+	case "argon2id":
+		argon := passwords.DefaultArgon2id()
+		argon.Time = uint32(getEnvInt("ARGON2_TIME", int(argon.Time)))
+		argon.Memory = uint32(getEnvInt("ARGON2_MEMORY_KB", int(argon.Memory)))
+		argon.Threads = uint8(getEnvInt("ARGON2_THREADS", int(argon.Threads)))
+		Database.PasswordHasher = argon
+		// The 72 byte limit only exists because bcrypt ignores the rest
+		ApiConfig.passwordPolicy.MaxLength = 256
+	default:
+		log.Fatalf("Unknown PASSWORD_HASHER %q, use bcrypt or argon2id", hasher)
+	}
+	dummyPasswordHash, err := Database.PasswordHasher.Hash("chirpy-unknown-user")
+	if err != nil {
+		log.Fatalf("Couldn't hash with the configured hasher: %s", err)
+	}
+	ApiConfig.dummyPasswordHash = dummyPasswordHash
+	ApiConfig.passwordPolicy.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", ApiConfig.passwordPolicy.MinLength)
+	ApiConfig.passwordPolicy.MaxLength = getEnvInt("PASSWORD_MAX_LENGTH", ApiConfig.passwordPolicy.MaxLength)
+	classes, err := passwords.ParseClasses(os.Getenv("PASSWORD_REQUIRED_CLASSES"))
+	if err != nil {
+		log.Fatalf("Couldn't read PASSWORD_REQUIRED_CLASSES: %s", err)
+	}
+	ApiConfig.passwordPolicy.RequiredClasses = classes
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := passwords.LoadBreachedList(path)
+		if err != nil {
+			log.Fatalf("Couldn't load breached password list: %s", err)
+		}
+		ApiConfig.passwordPolicy.Breached = breached
+	}
+
+	if path := os.Getenv("PROFANITY_LIST_FILE"); path != "" {
+		filter, err := moderation.LoadFilter(path)
+		if err != nil {
+			log.Fatalf("Couldn't load profanity list: %s", err)
+		}
+		ApiConfig.profanityFilter = filter
+	} else {
+		ApiConfig.profanityFilter = moderation.NewFilter(moderation.DefaultWords)
+	}
+
+	moderationConfig := moderation.DefaultConfig()
+	if path := os.Getenv("MODERATION_CONFIG_FILE"); path != "" {
+		config, err := moderation.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Couldn't load moderation config: %s", err)
+		}
+		moderationConfig = config
+	}
+	pipeline, err := moderation.NewPipelineFromConfig(moderationConfig)
+	if err != nil {
+		log.Fatalf("Couldn't build moderation pipeline: %s", err)
+	}
+	ApiConfig.moderation = pipeline
+
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		os.Exit(createAdminCommand(os.Args[2:]))
+	}
 
 	router := chi.NewRouter()
 	fsHandler := ApiConfig.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
@@ -24,25 +128,81 @@ func main() {
 	router.Handle("/app/*", fsHandler)
 
 	adminRouter := chi.NewRouter()
-	adminRouter.Get("/metrics", ApiConfig.metricsHandler)
+	adminRouter.Group(func(adminOnly chi.Router) {
+		adminOnly.Use(ApiConfig.middlewareRole(Database.RoleAdmin))
+		adminOnly.Get("/metrics", ApiConfig.metricsHandler)
+		adminOnly.Get("/profanity", ApiConfig.getProfanityHandler)
+		adminOnly.Post("/profanity", ApiConfig.addProfanityHandler)
+		adminOnly.Delete("/profanity/{word}", ApiConfig.deleteProfanityHandler)
+		adminOnly.Post("/users/{userID}/unlock", ApiConfig.unlockUserHandler)
+		adminOnly.Put("/users/{userID}/role", setRoleHandler)
+	})
+	adminRouter.Route("/moderation", func(moderationRouter chi.Router) {
+		moderationRouter.Use(ApiConfig.middlewareRole(Database.RoleModerator))
+		moderationRouter.Get("/", getModerationQueueHandler)
+		moderationRouter.Get("/audit", getModerationAuditHandler)
+		moderationRouter.Post("/{itemID}/approve", reviewModerationItemHandler(Database.ItemApproved))
+		moderationRouter.Post("/{itemID}/reject", reviewModerationItemHandler(Database.ItemRejected))
+		moderationRouter.Post("/{itemID}/remove", reviewModerationItemHandler(Database.ItemRemoved))
+	})
 	router.Mount("/admin", adminRouter)
 
 	apiRouter := chi.NewRouter()
 	apiRouter.Get("/healthz", healthzHandler)
-	apiRouter.HandleFunc("/reset", ApiConfig.resetHandler)
+	apiRouter.With(ApiConfig.middlewareRole(Database.RoleAdmin)).Post("/reset", ApiConfig.resetHandler)
 
+	apiRouter.Get("/chirps/trash", ApiConfig.getTrashHandler)
 	apiRouter.Get("/chirps/{chirpID}", getChirpHandler)
 	apiRouter.Get("/chirps", getChirpsHandler)
 	apiRouter.Post("/chirps", addChirpHandler)
 	apiRouter.Delete("/chirps/{chirpID}", deleteChirpHandler)
+	apiRouter.Post("/chirps/{chirpID}/restore", ApiConfig.restoreChirpHandler)
+	apiRouter.Post("/chirps/{chirpID}/like", likeChirpHandler)
+	apiRouter.Delete("/chirps/{chirpID}/like", unlikeChirpHandler)
 
 	apiRouter.Post("/users", addUserHandler)
 	apiRouter.Put("/users", modifyUserHandler)
-	apiRouter.Post("/login", loginHandler)
+	apiRouter.Patch("/users", patchUserHandler)
+	apiRouter.Delete("/users", ApiConfig.deleteUserHandler)
+	apiRouter.Get("/users/me/export", exportUserHandler)
+	apiRouter.Get("/users/verify", verifyEmailHandler)
+	apiRouter.Get("/users/email/confirm", confirmEmailChangeHandler)
+	apiRouter.Post("/users/verify/resend", ApiConfig.resendVerificationHandler)
+	apiRouter.Get("/users/{handle}", getProfileHandler)
+	apiRouter.Post("/users/{userID}/follow", followUserHandler)
+	apiRouter.Delete("/users/{userID}/follow", unfollowUserHandler)
+	apiRouter.Get("/users/{userID}/followers", getFollowersHandler)
+	apiRouter.Get("/users/{userID}/following", getFollowingHandler)
+	apiRouter.Post("/users/{userID}/block", addRelationHandler(Database.RelationBlock))
+	apiRouter.Delete("/users/{userID}/block", removeRelationHandler(Database.RelationBlock))
+	apiRouter.Post("/users/{userID}/mute", addRelationHandler(Database.RelationMute))
+	apiRouter.Delete("/users/{userID}/mute", removeRelationHandler(Database.RelationMute))
+	apiRouter.Get("/blocks", getRelationsHandler(Database.RelationBlock))
+	apiRouter.Get("/mutes", getRelationsHandler(Database.RelationMute))
+	apiRouter.Get("/timeline", getTimelineHandler)
+	apiRouter.Get("/stream", ApiConfig.streamHandler)
+	apiRouter.Get("/ws", ApiConfig.wsHandler)
+	apiRouter.Post("/login", ApiConfig.loginHandler)
+	apiRouter.Post("/login/2fa", ApiConfig.twoFactorLoginHandler)
+	apiRouter.Post("/2fa/enroll", enrollTwoFactorHandler)
+	apiRouter.Post("/2fa/confirm", ApiConfig.confirmTwoFactorHandler)
+	apiRouter.Delete("/2fa", ApiConfig.disableTwoFactorHandler)
+	apiRouter.Post("/password/forgot", ApiConfig.forgotPasswordHandler)
+	apiRouter.Post("/password/reset", resetPasswordHandler)
 	apiRouter.Post("/refresh", refreshTokenHandler)
 	apiRouter.Post("/revoke", revokeTokenHandler)
+	apiRouter.Get("/sessions", getSessionsHandler)
+	apiRouter.Delete("/sessions", deleteSessionsHandler)
+	apiRouter.Delete("/sessions/{sessionID}", deleteSessionHandler)
 	apiRouter.Post("/polka/webhooks", webhookHandler)
 
+	apiRouter.Post("/reports", ApiConfig.addReportHandler)
+	apiRouter.Get("/notifications", getNotificationsHandler)
+	apiRouter.Post("/notifications/read", markAllNotificationsReadHandler)
+	apiRouter.Post("/notifications/{notificationID}/read", markNotificationReadHandler)
+	apiRouter.Get("/notifications/preferences", getNotificationPreferencesHandler)
+	apiRouter.Put("/notifications/preferences", updateNotificationPreferencesHandler)
+
 	router.Mount("/api", apiRouter)
 
 	corsMux := middlewareCors(router)
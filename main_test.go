@@ -0,0 +1,88 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/moderation"
+	"chirpy/internal/passwords"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testAdminApiKey = "admin-key"
+
+// TestMain runs the handlers against a database in a directory of their own, they always
+// open the one in the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "chirpy-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	jwt.TimePrecision = time.Millisecond
+	// The cheapest cost keeps the tests fast, the stored hashes aren't the point
+	Database.PasswordHasher = passwords.Bcrypt{Cost: bcrypt.MinCost}
+	ApiConfig = setUpApiConfig(0, "secret", "polka")
+	ApiConfig.adminApiKey = testAdminApiKey
+	ApiConfig.profanityFilter = moderation.NewFilter(moderation.DefaultWords)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestDB empties the database of the working directory
+func newTestDB(t *testing.T) *Database.DB {
+	t.Helper()
+	if err := os.Remove("database.json"); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	db, err := Database.NewDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestUser creates a user with the given role and returns it with an access token
+// of a fresh session
+func newTestUser(t *testing.T, db *Database.DB, email, role string) (Database.User, string) {
+	t.Helper()
+	user, err := db.CreateUser(email, "password1")
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %s", email, err)
+	}
+	if role != Database.RoleUser {
+		if user, err = db.SetRole(user.Id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := db.CreateSession(user.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := createToken(user.Id, user.Role, session.Id, accessTokenSeconds, "chirpy-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+// serve sends a request with an optional bearer token to handler and records the response
+func serve(handler http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
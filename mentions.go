@@ -0,0 +1,31 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"regexp"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{3,15})\b`)
+
+// extractMentions returns the ids of the users mentioned with @handle in body, unknown
+// handles are ignored. blockedBy holds the handles of mentioned users who blocked the author
+func extractMentions(db *Database.DB, authorId int, body string) (mentions []int, blockedBy []string, err error) {
+	seen := make(map[int]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		user, err := db.GetUserByHandle(match[1])
+		if err != nil || seen[user.Id] || user.Id == authorId {
+			continue
+		}
+		seen[user.Id] = true
+		blocked, err := db.IsBlockedBy(user.Id, authorId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if blocked {
+			blockedBy = append(blockedBy, user.Handle)
+			continue
+		}
+		mentions = append(mentions, user.Id)
+	}
+	return mentions, blockedBy, nil
+}
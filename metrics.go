@@ -2,10 +2,17 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"net/http"
+	"strings"
 )
 
 func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var ruleHits strings.Builder
+	for _, hits := range cfg.moderation.Hits() {
+		ruleHits.WriteString(fmt.Sprintf("<li>%s: %d</li>", html.EscapeString(hits.Rule), hits.Hits))
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
 	w.Write([]byte(fmt.Sprintf(`<html>
@@ -13,10 +20,12 @@ func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	<body>
 		<h1>Welcome, Chirpy Admin</h1>
 		<p>Chirpy has been visited %d times!</p>
+		<h2>Moderation rule hits</h2>
+		<ul>%s</ul>
 	</body>
 	
 	</html>
-	`, cfg.fileserverHits)))
+	`, cfg.fileserverHits, ruleHits.String())))
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
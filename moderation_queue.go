@@ -0,0 +1,262 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func getModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type decision struct {
+		Rule   string `json:"rule"`
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+	type report struct {
+		Id         int       `json:"id"`
+		ReporterId int       `json:"reporter_id"`
+		Category   string    `json:"category"`
+		Text       string    `json:"text"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	type queueItem struct {
+		Id             int        `json:"id"`
+		ChirpId        int        `json:"chirp_id,omitempty"`
+		UserId         int        `json:"user_id,omitempty"`
+		Source         string     `json:"source"`
+		Reason         string     `json:"reason"`
+		Status         string     `json:"status"`
+		CreatedAt      time.Time  `json:"created_at"`
+		ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+		Reviewer       string     `json:"reviewer,omitempty"`
+		ReviewerNote   string     `json:"reviewer_note,omitempty"`
+		Body           string     `json:"body"`
+		AuthorId       int        `json:"author_id"`
+		AuthorEmail    string     `json:"author_email"`
+		AuthorRejected int        `json:"author_rejected"`
+		Decisions      []decision `json:"decisions"`
+		Reports        []report   `json:"reports"`
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = Database.ItemPending
+	} else if status == "all" {
+		status = ""
+	}
+
+	items, err := db.GetModerationItems(status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation queue")
+		return
+	}
+	audit, err := db.GetModerationAudit(nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation audit")
+		return
+	}
+	rejectedByAuthor := make(map[int]int)
+	for _, entry := range audit {
+		if entry.Action != Database.ItemApproved {
+			rejectedByAuthor[entry.AuthorId]++
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id < items[j].Id
+	})
+
+	var response = []queueItem{}
+	for _, item := range items {
+		chirp := Database.Chirp{AuthorId: item.UserId}
+		if item.ChirpId != 0 {
+			chirp, err = db.GetChirpForReview(item.ChirpId)
+			if err != nil {
+				continue
+			}
+		}
+		// Items about deleted accounts have nobody left to review
+		author, err := db.GetUser(chirp.AuthorId)
+		if err != nil {
+			continue
+		}
+		reports, err := db.GetReports(item.ChirpId, item.UserId)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve reports")
+			return
+		}
+		entry := queueItem{
+			Id:             item.Id,
+			ChirpId:        item.ChirpId,
+			UserId:         item.UserId,
+			Source:         item.Source,
+			Reason:         item.Reason,
+			Status:         item.Status,
+			CreatedAt:      item.CreatedAt,
+			ReviewedAt:     item.ReviewedAt,
+			Reviewer:       item.Reviewer,
+			ReviewerNote:   item.ReviewerNote,
+			Body:           chirp.Body,
+			AuthorId:       chirp.AuthorId,
+			AuthorEmail:    author.Email,
+			AuthorRejected: rejectedByAuthor[chirp.AuthorId],
+			Decisions:      []decision{},
+			Reports:        []report{},
+		}
+		for _, d := range chirp.Moderation {
+			entry.Decisions = append(entry.Decisions, decision{Rule: d.Rule, Action: d.Action, Reason: d.Reason})
+		}
+		for _, r := range reports {
+			entry.Reports = append(entry.Reports, report{Id: r.Id, ReporterId: r.ReporterId, Category: r.Category, Text: r.Text, CreatedAt: r.CreatedAt})
+		}
+		response = append(response, entry)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// reviewModerationItemHandler returns the handler for one review outcome: approve publishes
+// the chirp, reject keeps it unpublished and remove takes it down for good
+func reviewModerationItemHandler(outcome string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := Database.NewDB("")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+			return
+		}
+
+		type parameters struct {
+			Note string `json:"note"`
+		}
+		type returnVals struct {
+			Id           int       `json:"id"`
+			ChirpId      int       `json:"chirp_id,omitempty"`
+			UserId       int       `json:"user_id,omitempty"`
+			Status       string    `json:"status"`
+			ReviewedAt   time.Time `json:"reviewed_at"`
+			Reviewer     string    `json:"reviewer"`
+			ReviewerNote string    `json:"reviewer_note"`
+		}
+
+		itemId, err := strconv.Atoi(chi.URLParam(r, "itemID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid moderation item id")
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+			return
+		}
+		// The audit log names whoever authenticated, a request can't claim to be someone else
+		reviewer := "api-key"
+		if reviewerId := requestUserId(r); reviewerId != -1 {
+			reviewer = fmt.Sprintf("user:%d", reviewerId)
+		}
+
+		item, chirp, err := db.ReviewModerationItem(itemId, outcome, reviewer, params.Note)
+		if errors.Is(err, Database.ErrItemNotFound) || errors.Is(err, Database.ErrChirpNotFound) {
+			respondWithError(w, http.StatusNotFound, "Pending moderation item not found")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't review moderation item")
+			return
+		}
+
+		if item.ChirpId != 0 && outcome == Database.ItemApproved && chirp.DeletedAt == nil {
+			ApiConfig.publishChirp(events.ChirpCreated, chirp)
+		}
+
+		userId := chirp.AuthorId
+		message := fmt.Sprintf("Your chirp #%d was %s by a moderator", chirp.Id, outcome)
+		if item.ChirpId == 0 {
+			userId = item.UserId
+			message = fmt.Sprintf("The review of your account was closed as %s by a moderator", outcome)
+		}
+		if params.Note != "" {
+			message += ": " + params.Note
+		}
+		notification, _, err := db.CreateNotification(Database.Notification{
+			UserId:  userId,
+			Type:    Database.NotificationModeration,
+			ChirpId: chirp.Id,
+			Message: message,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't notify author")
+			return
+		}
+		ApiConfig.publishNotification(notification)
+
+		respondWithJSON(w, http.StatusOK, returnVals{
+			Id:           item.Id,
+			ChirpId:      item.ChirpId,
+			UserId:       item.UserId,
+			Status:       item.Status,
+			ReviewedAt:   *item.ReviewedAt,
+			Reviewer:     item.Reviewer,
+			ReviewerNote: item.ReviewerNote,
+		})
+	}
+}
+
+func getModerationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type auditEntry struct {
+		Id        int       `json:"id"`
+		ItemId    int       `json:"item_id"`
+		ChirpId   int       `json:"chirp_id"`
+		ChirpBody string    `json:"chirp_body"`
+		AuthorId  int       `json:"author_id"`
+		Action    string    `json:"action"`
+		Reviewer  string    `json:"reviewer"`
+		Note      string    `json:"note"`
+		Time      time.Time `json:"time"`
+	}
+
+	var chirpId *int
+	if stringChirpId := r.URL.Query().Get("chirp_id"); stringChirpId != "" {
+		id, err := strconv.Atoi(stringChirpId)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid chirp id")
+			return
+		}
+		chirpId = &id
+	}
+
+	entries, err := db.GetModerationAudit(chirpId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation audit")
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+
+	var response = []auditEntry{}
+	for _, entry := range entries {
+		response = append(response, auditEntry(entry))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
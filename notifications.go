@@ -0,0 +1,250 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultNotificationsLimit = 20
+	maxNotificationsLimit     = 100
+)
+
+// notify sends a notification for an event caused by ActorId. Users don't hear from the
+// people they blocked, and a failure is only logged so it never fails the event itself
+func notify(db *Database.DB, notification Database.Notification) {
+	if notification.UserId == notification.ActorId {
+		return
+	}
+	blocked, err := db.IsBlockedBy(notification.UserId, notification.ActorId)
+	if err != nil || blocked {
+		return
+	}
+	notification, created, err := db.CreateNotification(notification)
+	if err != nil {
+		log.Printf("Couldn't create %s notification for user %d: %s", notification.Type, notification.UserId, err)
+		return
+	}
+	if created {
+		ApiConfig.publishNotification(notification)
+	}
+}
+
+// actorName is how notification messages refer to a user, their handle when they have one
+func actorName(db *Database.DB, userId int) string {
+	user, err := db.GetUser(userId)
+	if err != nil || user.Handle == "" {
+		return fmt.Sprintf("User %d", userId)
+	}
+	return "@" + user.Handle
+}
+
+func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type notification struct {
+		Id        int        `json:"id"`
+		Type      string     `json:"type"`
+		ActorId   int        `json:"actor_id,omitempty"`
+		ChirpId   int        `json:"chirp_id,omitempty"`
+		Message   string     `json:"message"`
+		CreatedAt time.Time  `json:"created_at"`
+		ReadAt    *time.Time `json:"read_at"`
+	}
+	type returnVals struct {
+		Notifications []notification `json:"notifications"`
+		UnreadCount   int            `json:"unread_count"`
+		NextCursor    string         `json:"next_cursor,omitempty"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	before := 0
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		before, err = strconv.Atoi(cursor)
+		if err != nil || before <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	limit := defaultNotificationsLimit
+	if stringLimit := r.URL.Query().Get("limit"); stringLimit != "" {
+		limit, err = strconv.Atoi(stringLimit)
+		if err != nil || limit <= 0 || limit > maxNotificationsLimit {
+			respondWithError(w, http.StatusBadRequest, "Limit must be between 1 and "+strconv.Itoa(maxNotificationsLimit))
+			return
+		}
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, unread, err := db.GetNotifications(userId, before, limit, unreadOnly)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notifications")
+		return
+	}
+
+	response := returnVals{Notifications: []notification{}, UnreadCount: unread}
+	for _, n := range notifications {
+		response.Notifications = append(response.Notifications, notification{
+			Id:        n.Id,
+			Type:      n.Type,
+			ActorId:   n.ActorId,
+			ChirpId:   n.ChirpId,
+			Message:   n.Message,
+			CreatedAt: n.CreatedAt,
+			ReadAt:    n.ReadAt,
+		})
+	}
+	if len(notifications) == limit {
+		response.NextCursor = strconv.Itoa(notifications[len(notifications)-1].Id)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	markNotificationsRead(w, r, chi.URLParam(r, "notificationID"))
+}
+
+func markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	markNotificationsRead(w, r, "")
+}
+
+// markNotificationsRead marks one notification of the caller as read, or all of them when stringId is empty
+func markNotificationsRead(w http.ResponseWriter, r *http.Request, stringId string) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		Marked int `json:"marked"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	var ids []int
+	if stringId != "" {
+		id, err := strconv.Atoi(stringId)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid notification id")
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	marked, err := db.MarkNotificationsRead(userId, ids)
+	if errors.Is(err, Database.ErrNotificationNotFound) {
+		respondWithError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't mark notifications as read")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Marked: marked})
+}
+
+func getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	user, err := db.GetUser(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, notificationPreferences(user))
+}
+
+func updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := map[string]bool{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	var violations []validationError
+	for notificationType := range params {
+		valid := false
+		for _, configurable := range Database.NotificationTypes {
+			if notificationType == configurable {
+				valid = true
+			}
+		}
+		if !valid {
+			violations = append(violations, validationError{Rule: "type", Message: "Unknown notification type " + notificationType})
+		}
+	}
+	if len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid preferences", violations)
+		return
+	}
+
+	user, err := db.UpdateNotificationPreferences(userId, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update preferences")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, notificationPreferences(user))
+}
+
+// notificationPreferences lists every configurable type with whether the user gets it
+func notificationPreferences(user Database.User) map[string]bool {
+	preferences := make(map[string]bool)
+	for _, notificationType := range Database.NotificationTypes {
+		preferences[notificationType] = user.NotificationEnabled(notificationType)
+	}
+	return preferences
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/mailer"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const passwordResetExpiry = time.Hour
+
+// hashToken is how one-time tokens are stored, so a leaked database can't be used to log in
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func (cfg *apiConfig) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	type returnVals struct {
+		Message string `json:"message"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	// Known and unknown emails get the same response, and the email is sent in the
+	// background so response times don't tell them apart either
+	user, err := db.GetUserByEmail(params.Email)
+	if err == nil {
+		go cfg.sendPasswordReset(user)
+	} else if !errors.Is(err, Database.ErrUserNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, returnVals{Message: "If the email belongs to an account, a reset link is on its way"})
+}
+
+// sendPasswordReset creates a single-use reset token for user and mails it to them
+func (cfg *apiConfig) sendPasswordReset(user Database.User) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		log.Printf("Couldn't open database to reset password: %s", err)
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("Couldn't generate reset token: %s", err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	_, err = db.CreatePasswordReset(user.Id, hashToken(token), time.Now().Add(passwordResetExpiry))
+	if err != nil {
+		log.Printf("Couldn't store reset token for user %d: %s", user.Id, err)
+		return
+	}
+
+	// The page at reset-password/index.html asks for the new password and posts it with the token
+	link := cfg.publicURL + "/app/reset-password/?token=" + url.QueryEscape(token)
+	err = cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\nOpen this link within an hour to choose a new one:\n%s\n\nIf it wasn't you, you can ignore this email.", link),
+	})
+	if err != nil {
+		log.Printf("Couldn't send reset email to user %d: %s", user.Id, err)
+	}
+}
+
+func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	if params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	// The policy is checked before the token is used up, so a refused password can be retried
+	tokenHash := hashToken(params.Token)
+	userId, err := db.FindPasswordReset(tokenHash)
+	if errors.Is(err, Database.ErrResetInvalid) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+	user, err := db.GetUser(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	if violations := ApiConfig.validatePassword(params.Password, user.Email); len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid password", violations)
+		return
+	}
+	_, err = db.UsePasswordReset(tokenHash)
+	if errors.Is(err, Database.ErrResetInvalid) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+	_, err = db.UpdateUser(user.Id, user.Email, &params.Password, user.IsChirpyRed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+	err = db.RevokeUserTokens(user.Id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"chirpy/internal/moderation"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (cfg *apiConfig) getProfanityHandler(w http.ResponseWriter, r *http.Request) {
+	type returnVals struct {
+		Words []string `json:"words"`
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Words: cfg.profanityFilter.Words()})
+}
+
+func (cfg *apiConfig) addProfanityHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Words []string `json:"words"`
+	}
+	type returnVals struct {
+		Words []string `json:"words"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	if len(params.Words) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Missing words")
+		return
+	}
+
+	var violations []validationError
+	for _, word := range params.Words {
+		if !moderation.ValidWord(word) {
+			violations = append(violations, validationError{Rule: "words", Message: fmt.Sprintf("%q isn't a single word of letters and digits", word)})
+		}
+	}
+	if len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid words", violations)
+		return
+	}
+
+	err = cfg.profanityFilter.Add(params.Words...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save word list")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Words: cfg.profanityFilter.Words()})
+}
+
+func (cfg *apiConfig) deleteProfanityHandler(w http.ResponseWriter, r *http.Request) {
+	word := chi.URLParam(r, "word")
+	if word == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing word")
+		return
+	}
+
+	err := cfg.profanityFilter.Remove(word)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save word list")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+// reservedHandles are path segments under /api/users that a profile would hide behind, and
+// names that would pass for the site itself. They are compared ignoring case
+var reservedHandles = map[string]bool{
+	"me":         true,
+	"verify":     true,
+	"email":      true,
+	"admin":      true,
+	"moderation": true,
+	"chirpy":     true,
+	"support":    true,
+}
+
+// validateProfile checks the profile fields that are being changed
+func validateProfile(profile Database.ProfileUpdate) []validationError {
+	var violations []validationError
+	if profile.Handle != nil && !handlePattern.MatchString(*profile.Handle) {
+		violations = append(violations, validationError{Rule: "handle", Message: "Handle must be 3 to 15 letters, digits or underscores"})
+	}
+	if profile.Handle != nil && reservedHandles[strings.ToLower(*profile.Handle)] {
+		violations = append(violations, validationError{Rule: "handle", Message: "Handle is reserved"})
+	}
+	if profile.DisplayName != nil && len([]rune(*profile.DisplayName)) > maxDisplayNameLength {
+		violations = append(violations, validationError{Rule: "display_name", Message: fmt.Sprintf("Display name can't be longer than %d characters", maxDisplayNameLength)})
+	}
+	if profile.Bio != nil && len([]rune(*profile.Bio)) > maxBioLength {
+		violations = append(violations, validationError{Rule: "bio", Message: fmt.Sprintf("Bio can't be longer than %d characters", maxBioLength)})
+	}
+	if profile.AvatarURL != nil && *profile.AvatarURL != "" {
+		avatar, err := url.Parse(*profile.AvatarURL)
+		if err != nil || (avatar.Scheme != "http" && avatar.Scheme != "https") || avatar.Host == "" {
+			violations = append(violations, validationError{Rule: "avatar_url", Message: "Avatar must be an http or https URL"})
+		}
+	}
+	return violations
+}
+
+func getProfileHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		Id             int    `json:"id"`
+		Handle         string `json:"handle"`
+		DisplayName    string `json:"display_name"`
+		Bio            string `json:"bio"`
+		AvatarURL      string `json:"avatar_url"`
+		IsChirpyRed    bool   `json:"is_chirpy_red"`
+		ChirpCount     int    `json:"chirp_count"`
+		FollowerCount  int    `json:"follower_count"`
+		FollowingCount int    `json:"following_count"`
+	}
+
+	user, err := db.GetUserByHandle(chi.URLParam(r, "handle"))
+	if err != nil || user.Hidden {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	counts, err := db.GetProfileCounts(user.Id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve profile")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, returnVals{
+		Id:             user.Id,
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarURL,
+		IsChirpyRed:    user.IsChirpyRed,
+		ChirpCount:     counts.Chirps,
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// addRelationHandler returns the handler blocking or muting the user in the url
+func addRelationHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := Database.NewDB("")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+			return
+		}
+
+		stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+		userId, errorCode := verifyToken("chirpy-access", stringToken)
+		if errorCode != 0 {
+			respondWithError(w, errorCode, "Unauthorized")
+			return
+		}
+
+		targetId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+		if targetId == userId {
+			respondWithError(w, http.StatusBadRequest, "You can't "+kind+" yourself")
+			return
+		}
+		if _, err := db.GetUser(targetId); err != nil {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		_, err = db.AddRelation(userId, targetId, kind)
+		if err != nil && !errors.Is(err, Database.ErrRelationExists) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't "+kind+" user")
+			return
+		}
+		respondWithoutJSON(w, http.StatusNoContent)
+	}
+}
+
+// removeRelationHandler returns the handler unblocking or unmuting the user in the url
+func removeRelationHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := Database.NewDB("")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+			return
+		}
+
+		stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+		userId, errorCode := verifyToken("chirpy-access", stringToken)
+		if errorCode != 0 {
+			respondWithError(w, errorCode, "Unauthorized")
+			return
+		}
+
+		targetId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+
+		err = db.RemoveRelation(userId, targetId, kind)
+		if errors.Is(err, Database.ErrRelationNotFound) {
+			respondWithError(w, http.StatusNotFound, "You didn't "+kind+" this user")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't un"+kind+" user")
+			return
+		}
+		respondWithoutJSON(w, http.StatusNoContent)
+	}
+}
+
+// getRelationsHandler returns the handler listing the users blocked or muted by the caller
+func getRelationsHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := Database.NewDB("")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+			return
+		}
+
+		type relatedUser struct {
+			Id        int       `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+		}
+
+		stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+		userId, errorCode := verifyToken("chirpy-access", stringToken)
+		if errorCode != 0 {
+			respondWithError(w, errorCode, "Unauthorized")
+			return
+		}
+
+		relations, err := db.GetRelations(userId, kind)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve users")
+			return
+		}
+
+		var response = []relatedUser{}
+		for _, relation := range relations {
+			response = append(response, relatedUser{Id: relation.TargetId, CreatedAt: relation.CreatedAt})
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
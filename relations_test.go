@@ -0,0 +1,100 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestChirpsOfBlockedAndMutedAuthors(t *testing.T) {
+	db := newTestDB(t)
+	viewer, token := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	blocked, blockedToken := newTestUser(t, db, "b@example.com", Database.RoleUser)
+	muted, _ := newTestUser(t, db, "c@example.com", Database.RoleUser)
+	authors := []int{viewer.Id, blocked.Id, muted.Id}
+	chirpIds := make(map[int]int)
+	for _, id := range authors {
+		chirp, err := db.CreateChirp(Database.Chirp{Body: "hello", AuthorId: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chirpIds[id] = chirp.Id
+	}
+	if _, err := db.AddRelation(viewer.Id, blocked.Id, Database.RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddRelation(viewer.Id, muted.Id, Database.RelationMute); err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Get("/api/chirps", getChirpsHandler)
+	router.Get("/api/chirps/{chirpID}", getChirpHandler)
+	listAuthors := func(target, token string) map[int]bool {
+		t.Helper()
+		w := serve(router, http.MethodGet, target, token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want %d", target, w.Code, http.StatusOK)
+		}
+		var chirps []struct {
+			AuthorId int `json:"author_id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&chirps); err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[int]bool)
+		for _, chirp := range chirps {
+			found[chirp.AuthorId] = true
+		}
+		return found
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		want   map[int]bool
+	}{
+		{"feed of the blocker", "/api/chirps", token, map[int]bool{viewer.Id: true}},
+		{"blocked author", "/api/chirps?author_id=" + strconv.Itoa(blocked.Id), token, map[int]bool{}},
+		// Muting only drops an author out of the feed
+		{"muted author", "/api/chirps?author_id=" + strconv.Itoa(muted.Id), token, map[int]bool{muted.Id: true}},
+		{"feed of the blocked user", "/api/chirps", blockedToken, map[int]bool{viewer.Id: true, blocked.Id: true, muted.Id: true}},
+		{"anonymous feed", "/api/chirps", "", map[int]bool{viewer.Id: true, blocked.Id: true, muted.Id: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := listAuthors(test.target, test.token)
+			if len(found) != len(test.want) {
+				t.Fatalf("authors = %v, want %v", found, test.want)
+			}
+			for id := range test.want {
+				if !found[id] {
+					t.Errorf("authors = %v, want %v", found, test.want)
+				}
+			}
+		})
+	}
+
+	chirpTests := []struct {
+		name   string
+		author int
+		want   int
+	}{
+		{"chirp of a blocked author", blocked.Id, http.StatusNotFound},
+		{"chirp of a muted author", muted.Id, http.StatusOK},
+		{"own chirp", viewer.Id, http.StatusOK},
+	}
+	for _, test := range chirpTests {
+		t.Run(test.name, func(t *testing.T) {
+			target := "/api/chirps/" + strconv.Itoa(chirpIds[test.author])
+			if w := serve(router, http.MethodGet, target, token); w.Code != test.want {
+				t.Errorf("GET %s = %d, want %d", target, w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var reportCategories = []string{"spam", "harassment", "hate", "violence", "misinformation", "other"}
+
+const maxReportTextLength = 1000
+
+func (cfg *apiConfig) addReportHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		ChirpId  int    `json:"chirp_id"`
+		UserId   int    `json:"user_id"`
+		Category string `json:"category"`
+		Text     string `json:"text"`
+	}
+	type returnVals struct {
+		Id        int       `json:"id"`
+		ChirpId   int       `json:"chirp_id,omitempty"`
+		UserId    int       `json:"user_id,omitempty"`
+		Category  string    `json:"category"`
+		Text      string    `json:"text"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	reporterId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	var violations []validationError
+	if (params.ChirpId == 0) == (params.UserId == 0) {
+		violations = append(violations, validationError{Rule: "one_target", Message: "Report either a chirp_id or a user_id"})
+	}
+	validCategory := false
+	for _, category := range reportCategories {
+		if params.Category == category {
+			validCategory = true
+		}
+	}
+	if !validCategory {
+		violations = append(violations, validationError{Rule: "category", Message: "Category must be one of " + strings.Join(reportCategories, ", ")})
+	}
+	if len([]rune(params.Text)) > maxReportTextLength {
+		violations = append(violations, validationError{Rule: "max_length", Message: fmt.Sprintf("Text can't be longer than %d characters", maxReportTextLength)})
+	}
+	if len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid report", violations)
+		return
+	}
+
+	targetOwner := params.UserId
+	if params.ChirpId != 0 {
+		chirp, err := db.GetChirp(reporterId, params.ChirpId)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		targetOwner = chirp.AuthorId
+	} else if _, err := db.GetUser(params.UserId); err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if targetOwner == reporterId {
+		respondWithError(w, http.StatusBadRequest, "You can't report yourself")
+		return
+	}
+
+	report, reporters, err := db.CreateReport(Database.Report{
+		ReporterId: reporterId,
+		ChirpId:    params.ChirpId,
+		UserId:     params.UserId,
+		Category:   params.Category,
+		Text:       params.Text,
+	})
+	if errors.Is(err, Database.ErrDuplicateReport) {
+		respondWithError(w, http.StatusConflict, "You already reported this")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create report")
+		return
+	}
+
+	if reporters >= cfg.reportThreshold {
+		err = cfg.hideReported(db, report)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hide reported content")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusCreated, returnVals{
+		Id:        report.Id,
+		ChirpId:   report.ChirpId,
+		UserId:    report.UserId,
+		Category:  report.Category,
+		Text:      report.Text,
+		CreatedAt: report.CreatedAt,
+	})
+}
+
+// hideReported hides the target of a report that reached the threshold and queues it for review
+func (cfg *apiConfig) hideReported(db *Database.DB, report Database.Report) error {
+	var err error
+	if report.ChirpId != 0 {
+		err = db.HideChirp(report.ChirpId)
+	} else {
+		err = db.SetUserHidden(report.UserId, true)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.CreateModerationItem(report.ChirpId, report.UserId, "reports", fmt.Sprintf("Reported by %d users", cfg.reportThreshold))
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type contextKey string
+
+const userIdKey contextKey = "userId"
+
+// middlewareRole only lets through users with at least the given role. The admin api key
+// counts as an admin, for scripts that don't log in
+func (cfg *apiConfig) middlewareRole(minimum string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if strings.HasPrefix(authorization, "ApiKey ") {
+				if cfg.adminApiKey == "" || strings.TrimPrefix(authorization, "ApiKey ") != cfg.adminApiKey {
+					respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIdKey, -1)))
+				return
+			}
+
+			id, role, errorCode := verifyAccessRole(strings.TrimPrefix(authorization, "Bearer "))
+			if errorCode != 0 {
+				respondWithError(w, errorCode, "Unauthorized")
+				return
+			}
+			if !Database.RoleAtLeast(role, minimum) {
+				respondWithError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			// The claim can be up to an hour old, a demotion takes effect right away
+			db, err := Database.NewDB("")
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+				return
+			}
+			user, err := db.GetUser(id)
+			if err != nil || !Database.RoleAtLeast(user.Role, minimum) {
+				respondWithError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIdKey, id)))
+		})
+	}
+}
+
+// requestUserId returns the user let through by middlewareRole, -1 for the admin api key
+func requestUserId(r *http.Request) int {
+	id, ok := r.Context().Value(userIdKey).(int)
+	if !ok {
+		return -1
+	}
+	return id
+}
+
+func setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	type returnVals struct {
+		Id   int    `json:"id"`
+		Role string `json:"role"`
+	}
+
+	userId, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	// Admins can't demote themselves, so there is always an admin left to fix mistakes
+	if userId == requestUserId(r) && params.Role != Database.RoleAdmin {
+		respondWithError(w, http.StatusConflict, "You can't change your own role")
+		return
+	}
+
+	user, err := db.SetRole(userId, params.Role)
+	if errors.Is(err, Database.ErrUnknownRole) {
+		respondWithValidationErrors(w, "Invalid role", []validationError{{Rule: "role", Message: "Role must be user, moderator or admin"}})
+		return
+	}
+	if errors.Is(err, Database.ErrUserNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't change role")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Role: user.Role})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareRole(t *testing.T) {
+	db := newTestDB(t)
+	user, userToken := newTestUser(t, db, "user@example.com", Database.RoleUser)
+	moderator, moderatorToken := newTestUser(t, db, "moderator@example.com", Database.RoleModerator)
+	admin, adminToken := newTestUser(t, db, "admin@example.com", Database.RoleAdmin)
+	demoted, demotedToken := newTestUser(t, db, "demoted@example.com", Database.RoleAdmin)
+	// The token still claims admin for up to an hour
+	if _, err := db.SetRole(demoted.Id, Database.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		minimum       string
+		authorization string
+		wantCode      int
+		wantUserId    int
+	}{
+		{"no token", Database.RoleAdmin, "", http.StatusUnauthorized, 0},
+		{"invalid token", Database.RoleAdmin, "Bearer invalid", http.StatusUnauthorized, 0},
+		{"user for admin", Database.RoleAdmin, "Bearer " + userToken, http.StatusForbidden, 0},
+		{"moderator for admin", Database.RoleAdmin, "Bearer " + moderatorToken, http.StatusForbidden, 0},
+		{"demoted admin", Database.RoleAdmin, "Bearer " + demotedToken, http.StatusForbidden, 0},
+		{"admin", Database.RoleAdmin, "Bearer " + adminToken, http.StatusOK, admin.Id},
+		{"moderator for moderator", Database.RoleModerator, "Bearer " + moderatorToken, http.StatusOK, moderator.Id},
+		{"admin for moderator", Database.RoleModerator, "Bearer " + adminToken, http.StatusOK, admin.Id},
+		{"user for user", Database.RoleUser, "Bearer " + userToken, http.StatusOK, user.Id},
+		{"api key", Database.RoleAdmin, "ApiKey " + testAdminApiKey, http.StatusOK, -1},
+		{"wrong api key", Database.RoleAdmin, "ApiKey wrong", http.StatusUnauthorized, 0},
+		{"empty api key", Database.RoleAdmin, "ApiKey ", http.StatusUnauthorized, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotUserId := 0
+			handler := ApiConfig.middlewareRole(test.minimum)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserId = requestUserId(r)
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.wantCode || gotUserId != test.wantUserId {
+				t.Errorf("middlewareRole = %d for user %d, want %d for user %d", w.Code, gotUserId, test.wantCode, test.wantUserId)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRoleWithoutApiKey(t *testing.T) {
+	newTestDB(t)
+	// Without a configured key, an empty one must not let anybody in
+	cfg := setUpApiConfig(0, "secret", "polka")
+	handler := cfg.middlewareRole(Database.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+	r.Header.Set("Authorization", "ApiKey ")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("middlewareRole with an empty api key = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
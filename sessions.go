@@ -0,0 +1,149 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxUserAgentLength = 256
+
+// userAgent returns the user agent of a request, cut to a length worth storing
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	if len(agent) > maxUserAgentLength {
+		agent = agent[:maxUserAgentLength]
+	}
+	return agent
+}
+
+// accessSession returns the user and session of the access token in the request
+func accessSession(r *http.Request) (int, int, int) {
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		return -1, 0, errorCode
+	}
+	claims, err := tokenClaims(stringToken)
+	if err != nil {
+		return -1, 0, http.StatusUnauthorized
+	}
+	return userId, claims.SessionId, 0
+}
+
+func getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type session struct {
+		Id         int       `json:"id"`
+		UserAgent  string    `json:"user_agent"`
+		IP         string    `json:"ip"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		Current    bool      `json:"current"`
+	}
+
+	userId, sessionId, errorCode := accessSession(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	sessions, err := db.GetSessions(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions")
+		return
+	}
+	response := []session{}
+	for _, s := range sessions {
+		response = append(response, session{
+			Id:         s.Id,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			Current:    s.Id == sessionId,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	userId, _, errorCode := accessSession(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session id")
+		return
+	}
+
+	err = db.RevokeSession(userId, id)
+	if errors.Is(err, Database.ErrSessionNotFound) {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+// deleteSessionsHandler logs the user out everywhere, the current device included
+func deleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	userId, _, errorCode := accessSession(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	err = db.RevokeUserTokens(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+// purgeSessions removes sessions whose refresh token has expired, every interval
+func purgeSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		db, err := Database.NewDB("")
+		if err != nil {
+			log.Printf("Couldn't open database to purge sessions: %s", err)
+			continue
+		}
+		_, err = db.PurgeSessions(time.Duration(refreshTokenSeconds) * time.Second)
+		if err != nil {
+			log.Printf("Couldn't purge sessions: %s", err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+var tagPattern = regexp.MustCompile(`(?:^|[^\w#])#(\w+)`)
+
+// extractTags returns the lowercased #tags of a chirp body
+func extractTags(body string) []string {
+	var tags []string
+	for _, match := range tagPattern.FindAllStringSubmatch(body, -1) {
+		tags = append(tags, strings.ToLower(match[1]))
+	}
+	return tags
+}
+
+// publishChirp raises an event about chirp on the event bus
+func (cfg *apiConfig) publishChirp(eventType string, chirp Database.Chirp) {
+	event := events.Event{
+		Type:       eventType,
+		ChirpId:    chirp.Id,
+		AuthorId:   chirp.AuthorId,
+		ReplyToId:  chirp.ReplyToId,
+		Tags:       extractTags(chirp.Body),
+		Visibility: chirp.Visibility,
+	}
+	if eventType != events.ChirpDeleted {
+		event.Body = cfg.profanityFilter.Mask(chirp.Body)
+	}
+	cfg.events.Publish(event)
+}
+
+// canReceive reports whether an event should be streamed to viewerId with the given filters.
+// Only public chirps are streamed, except to their own author
+func canReceive(event events.Event, viewerId, authorId int, tag string, excluded map[int]bool) bool {
+	if !event.IsChirpEvent() {
+		return false
+	}
+	if event.Visibility != "" && event.Visibility != Database.VisibilityPublic && event.AuthorId != viewerId {
+		return false
+	}
+	if excluded[event.AuthorId] || (authorId != 0 && event.AuthorId != authorId) {
+		return false
+	}
+	if tag == "" {
+		return true
+	}
+	for _, eventTag := range event.Tags {
+		if eventTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) streamHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	viewerId, errorCode := optionalAccessToken(r)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	authorId := 0
+	if stringAuthorId := r.URL.Query().Get("author_id"); stringAuthorId != "" {
+		authorId, err = strconv.Atoi(stringAuthorId)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author id")
+			return
+		}
+	}
+	tag := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("tag"), "#"))
+
+	stringLastId := r.Header.Get("Last-Event-ID")
+	if stringLastId == "" {
+		stringLastId = r.URL.Query().Get("last_event_id")
+	}
+	var lastId uint64
+	if stringLastId != "" {
+		lastId, err = strconv.ParseUint(stringLastId, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid last event id")
+			return
+		}
+	}
+
+	excluded, err := db.GetExcludedAuthors(viewerId, true)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open stream")
+		return
+	}
+
+	subscription, missed, unsubscribe := cfg.events.Subscribe(lastId)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(event events.Event) error {
+		if !canReceive(event, viewerId, authorId, tag, excluded) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+		return err
+	}
+
+	for _, event := range missed {
+		if send(event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscription:
+			if !ok {
+				// Too slow to keep up, the client resumes with Last-Event-ID
+				return
+			}
+			if send(event) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// publishNotification raises an event for the user who received notification
+func (cfg *apiConfig) publishNotification(notification Database.Notification) {
+	cfg.events.Publish(events.Event{
+		Type:           events.NotificationCreated,
+		UserId:         notification.UserId,
+		ChirpId:        notification.ChirpId,
+		Body:           notification.Message,
+		NotificationId: notification.Id,
+	})
+}
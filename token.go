@@ -2,6 +2,8 @@ package main
 
 import (
 	Database "chirpy/internal"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,29 +12,96 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func createToken(id, expiritySeconds int, issuer string) (string, error) {
+const (
+	accessTokenSeconds  = 60 * 60
+	refreshTokenSeconds = 60 * 60 * 24 * 60
+)
+
+// userClaims add the role of the user, so routes can be guarded by role, and the session
+// the token belongs to
+type userClaims struct {
+	Role      string `json:"role,omitempty"`
+	SessionId int    `json:"sid,omitempty"`
+	// Generation tells refresh tokens of the same session apart, see Database.RotateSession
+	Generation int `json:"gen,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// createToken signs a token for user id. The role is only set on access tokens, the session
+// on access and refresh tokens
+func createToken(id int, role string, sessionId int, expiritySeconds int, issuer string) (string, error) {
+	return signUserClaims(id, userClaims{Role: role, SessionId: sessionId}, expiritySeconds, issuer)
+}
+
+// createRefreshToken signs the refresh token of the current generation of a session
+func createRefreshToken(session Database.Session) (string, error) {
+	return signUserClaims(session.UserId, userClaims{SessionId: session.Id, Generation: session.Generation}, refreshTokenSeconds, "chirpy-refresh")
+}
+
+func signUserClaims(id int, claims userClaims, expiritySeconds int, issuer string) (string, error) {
 	issuedAt := time.Now()
 	expirity := time.Now().Add(time.Second * time.Duration(expiritySeconds))
 
 	key := []byte(ApiConfig.jwtScret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+	claims.RegisteredClaims = jwt.RegisteredClaims{
 		Issuer:    issuer,
 		IssuedAt:  jwt.NewNumericDate(issuedAt),
 		ExpiresAt: jwt.NewNumericDate(expirity),
 		Subject:   strconv.Itoa(id),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
+}
+
+// emailClaims bind a token to the email it was sent to, so it stops working if the email changes
+type emailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// createEmailToken creates a signed token for links sent by email
+func createEmailToken(id int, email string, expiritySeconds int, issuer string) (string, error) {
+	issuedAt := time.Now()
+	expirity := time.Now().Add(time.Second * time.Duration(expiritySeconds))
+
+	key := []byte(ApiConfig.jwtScret)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, emailClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expirity),
+			Subject:   strconv.Itoa(id),
+		},
 	})
 	return token.SignedString(key)
 }
 
+// verifyEmailToken returns the user and email a token from createEmailToken was issued for
+func verifyEmailToken(issuer, stringToken string) (int, string, error) {
+	claims := &emailClaims{}
+	token, err := jwt.ParseWithClaims(stringToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ApiConfig.jwtScret), nil
+	})
+	if err != nil || !token.Valid || claims.Issuer != issuer {
+		return -1, "", errors.New("Invalid token")
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return -1, "", err
+	}
+	return id, claims.Email, nil
+}
+
 func verifyToken(issuer, stringToken string) (int, int) {
-	token, err := jwt.ParseWithClaims(stringToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(stringToken, &userClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(ApiConfig.jwtScret), nil
 	})
 	if err != nil {
 		return -1, http.StatusUnauthorized
 	}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*userClaims); ok && token.Valid {
 		if claims.Issuer != issuer {
 			return -1, http.StatusUnauthorized
 		}
@@ -40,12 +109,100 @@ func verifyToken(issuer, stringToken string) (int, int) {
 		if err != nil {
 			return -1, http.StatusInternalServerError
 		}
+		if issuer == "chirpy-access" {
+			if errorCode := checkAccessToken(id, claims); errorCode != 0 {
+				return -1, errorCode
+			}
+		}
 		return id, 0
 	} else {
 		return -1, http.StatusUnauthorized
 	}
 }
 
+// verifyAccessRole returns the user and role of an access token
+func verifyAccessRole(stringToken string) (int, string, int) {
+	claims := &userClaims{}
+	token, err := jwt.ParseWithClaims(stringToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ApiConfig.jwtScret), nil
+	})
+	if err != nil || !token.Valid || claims.Issuer != "chirpy-access" {
+		return -1, "", http.StatusUnauthorized
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return -1, "", http.StatusInternalServerError
+	}
+	if errorCode := checkAccessToken(id, claims); errorCode != 0 {
+		return -1, "", errorCode
+	}
+	return id, claims.Role, 0
+}
+
+// checkAccessToken rejects access tokens that outlived their account, their session, or were
+// issued before all tokens of the user were revoked. Tokens from before sessions existed have
+// no session to check
+func checkAccessToken(id int, claims *userClaims) int {
+	db, err := Database.NewDB("")
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	user, err := db.GetUser(id)
+	if errors.Is(err, Database.ErrUserNotFound) {
+		return http.StatusUnauthorized
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.Before(user.TokensValidAfter) {
+		return http.StatusUnauthorized
+	}
+	if claims.SessionId != 0 {
+		_, err = db.GetSession(id, claims.SessionId)
+		if errors.Is(err, Database.ErrSessionNotFound) {
+			return http.StatusUnauthorized
+		}
+		if err != nil {
+			return http.StatusInternalServerError
+		}
+	}
+	return 0
+}
+
+// tokenClaims returns the claims of a token already checked with verifyToken
+func tokenClaims(stringToken string) (*userClaims, error) {
+	claims := &userClaims{}
+	_, err := jwt.ParseWithClaims(stringToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ApiConfig.jwtScret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, errors.New("Token without expiry")
+	}
+	return claims, nil
+}
+
+// tokenExpiry returns when a token, already checked with verifyToken, expires
+func tokenExpiry(stringToken string) (time.Time, error) {
+	claims, err := tokenClaims(stringToken)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return claims.ExpiresAt.Time, nil
+}
+
+// optionalAccessToken returns the user of the access token in the request, or -1 when the
+// request has no token. An invalid token still fails with its error code
+func optionalAccessToken(r *http.Request) (int, int) {
+	if r.Header.Get("authorization") == "" {
+		return -1, 0
+	}
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	return verifyToken("chirpy-access", stringToken)
+}
+
 func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	db, err := Database.NewDB("")
 	if err != nil {
@@ -72,16 +229,53 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	user, err := db.GetUser(id)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	claims, err := tokenClaims(stringToken)
+	if err != nil || claims.IssuedAt.Before(user.TokensValidAfter) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	// Every refresh token is used once: the session moves on to a new one. Tokens from before
+	// sessions existed get a session of their own and are revoked, RevokeToken fails for all
+	// but the first of concurrent refreshes
+	var session Database.Session
+	if claims.SessionId != 0 {
+		session, err = db.RotateSession(id, claims.SessionId, claims.Generation, clientIP(r))
+		if errors.Is(err, Database.ErrTokenReused) {
+			log.Printf("Refresh token of session %d of user %d was reused, the session is revoked", claims.SessionId, id)
+		}
+	} else {
+		err = db.RevokeToken(stringToken)
+		if err == nil {
+			session, err = db.CreateSession(id, userAgent(r), clientIP(r))
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	type returnVals struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	accessToken, err := createToken(id, 60*60, "chirpy-access")
+	accessToken, err := createToken(id, user.Role, session.Id, accessTokenSeconds, "chirpy-access")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error creating the access-JWT")
 		return
 	}
-	respondWithJSON(w, http.StatusOK, returnVals{Token: accessToken})
+	refreshToken, err := createRefreshToken(session)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating the refresh-JWT")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Token: accessToken, RefreshToken: refreshToken})
 }
 
 func revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -100,5 +294,8 @@ func revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db.RevokeToken(stringToken)
+	if claims, err := tokenClaims(stringToken); err == nil && claims.SessionId != 0 {
+		db.RevokeSession(id, claims.SessionId)
+	}
 	respondWithoutJSON(w, http.StatusOK)
 }
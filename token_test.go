@@ -0,0 +1,159 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyAccessToken(t *testing.T) {
+	db := newTestDB(t)
+	user, token := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	if id, errorCode := verifyToken("chirpy-access", token); id != user.Id || errorCode != 0 {
+		t.Errorf("verifyToken = %d, %d, want %d, 0", id, errorCode, user.Id)
+	}
+	if id, errorCode := verifyToken("chirpy-refresh", token); id != -1 || errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyToken as a refresh token = %d, %d, want -1, %d", id, errorCode, http.StatusUnauthorized)
+	}
+
+	claims, err := tokenClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeSession(user.Id, claims.SessionId); err != nil {
+		t.Fatal(err)
+	}
+	if id, errorCode := verifyToken("chirpy-access", token); id != -1 || errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyToken of a revoked session = %d, %d, want -1, %d", id, errorCode, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyAccessTokenRevokedUser(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	// Tokens from before sessions existed are only stopped by TokensValidAfter
+	token, err := createToken(user.Id, user.Role, 0, accessTokenSeconds, "chirpy-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeUserTokens(user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if id, errorCode := verifyToken("chirpy-access", token); id != -1 || errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyToken issued before revoking = %d, %d, want -1, %d", id, errorCode, http.StatusUnauthorized)
+	}
+	if _, _, errorCode := verifyAccessRole(token); errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyAccessRole issued before revoking = %d, want %d", errorCode, http.StatusUnauthorized)
+	}
+
+	// Issue times are kept to the millisecond, a token of the same millisecond counts as earlier
+	time.Sleep(2 * time.Millisecond)
+	token, err = createToken(user.Id, user.Role, 0, accessTokenSeconds, "chirpy-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, errorCode := verifyToken("chirpy-access", token); id != user.Id || errorCode != 0 {
+		t.Errorf("verifyToken issued after revoking = %d, %d, want %d, 0", id, errorCode, user.Id)
+	}
+}
+
+func TestVerifyAccessTokenDeletedUser(t *testing.T) {
+	db := newTestDB(t)
+	user, token := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	if _, err := db.DeleteUser(user.Id, Database.DeletedChirpsDelete); err != nil {
+		t.Fatal(err)
+	}
+	if id, errorCode := verifyToken("chirpy-access", token); id != -1 || errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyToken of a deleted user = %d, %d, want -1, %d", id, errorCode, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifyTokenSignature(t *testing.T) {
+	db := newTestDB(t)
+	_, token := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"garbage", "not.a.token"},
+		{"tampered signature", token + "x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if id, errorCode := verifyToken("chirpy-access", test.token); id != -1 || errorCode != http.StatusUnauthorized {
+				t.Errorf("verifyToken = %d, %d, want -1, %d", id, errorCode, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// refresh exchanges a refresh token and returns the status with the new tokens
+func refresh(t *testing.T, refreshToken string) (int, string, string) {
+	t.Helper()
+	w := serve(http.HandlerFunc(refreshTokenHandler), http.MethodPost, "/api/refresh", refreshToken)
+	var tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, tokens.Token, tokens.RefreshToken
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	session, err := db.CreateSession(user.Id, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := createRefreshToken(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, accessToken, second := refresh(t, first)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("refresh = %d with refresh token %q, want %d and a new refresh token", code, second, http.StatusOK)
+	}
+	if id, errorCode := verifyToken("chirpy-access", accessToken); id != user.Id || errorCode != 0 {
+		t.Errorf("verifyToken of the new access token = %d, %d, want %d, 0", id, errorCode, user.Id)
+	}
+
+	// The first token leaked: its reuse ends the session for everyone holding a token of it
+	if code, _, _ := refresh(t, first); code != http.StatusUnauthorized {
+		t.Errorf("refresh with a used token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _, _ := refresh(t, second); code != http.StatusUnauthorized {
+		t.Errorf("refresh with the latest token after reuse = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, errorCode := verifyToken("chirpy-access", accessToken); errorCode != http.StatusUnauthorized {
+		t.Errorf("verifyToken of an access token of the revoked session = %d, want %d", errorCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshLegacyTokenOnce(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := newTestUser(t, db, "a@example.com", Database.RoleUser)
+	// Refresh tokens from before sessions existed carry no session
+	legacy, err := createToken(user.Id, "", 0, refreshTokenSeconds, "chirpy-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, rotated := refresh(t, legacy)
+	if code != http.StatusOK {
+		t.Fatalf("refresh with a legacy token = %d, want %d", code, http.StatusOK)
+	}
+	if claims, err := tokenClaims(rotated); err != nil || claims.SessionId == 0 {
+		t.Errorf("refresh token for a legacy token = %v, %v, want one with a session", claims, err)
+	}
+	if code, _, _ := refresh(t, legacy); code != http.StatusUnauthorized {
+		t.Errorf("refresh with a legacy token twice = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
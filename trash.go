@@ -0,0 +1,136 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (cfg *apiConfig) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals []struct {
+		Body      string    `json:"body"`
+		Id        int       `json:"id"`
+		AuthorId  int       `json:"author_id"`
+		DeletedAt time.Time `json:"deleted_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	chirps, err := db.GetDeletedChirps(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].DeletedAt.After(*chirps[j].DeletedAt)
+	})
+
+	var response = returnVals{}
+	for _, chirp := range chirps {
+		response = append(response, struct {
+			Body      string    `json:"body"`
+			Id        int       `json:"id"`
+			AuthorId  int       `json:"author_id"`
+			DeletedAt time.Time `json:"deleted_at"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}{
+			Body:      cfg.profanityFilter.Mask(chirp.Body),
+			Id:        chirp.Id,
+			AuthorId:  chirp.AuthorId,
+			DeletedAt: *chirp.DeletedAt,
+			ExpiresAt: chirp.DeletedAt.Add(cfg.trashRetention),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) restoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		AuthorId int    `json:"author_id"`
+		Id       int    `json:"id"`
+		Body     string `json:"body"`
+	}
+
+	stringChirpId := chi.URLParam(r, "chirpID")
+	if stringChirpId == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing chirp id")
+		return
+	}
+	chirpId, err := strconv.Atoi(stringChirpId)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't convert string to int")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	chirp, err := db.RestoreChirp(chirpId, userId, cfg.trashRetention)
+	if errors.Is(err, Database.ErrRestoreExpired) {
+		respondWithError(w, http.StatusGone, "Chirp can no longer be restored")
+		return
+	}
+	if errors.Is(err, Database.ErrChirpNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found in trash")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore chirp")
+		return
+	}
+	cfg.publishChirp(events.ChirpRestored, chirp)
+	respondWithJSON(w, http.StatusOK, returnVals{AuthorId: chirp.AuthorId, Body: cfg.profanityFilter.Mask(chirp.Body), Id: chirp.Id})
+}
+
+// purgeTrash hard-deletes chirps whose retention window has passed, every interval
+func (cfg *apiConfig) purgeTrash(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		db, err := Database.NewDB("")
+		if err != nil {
+			log.Printf("Couldn't open database to purge trash: %s", err)
+			continue
+		}
+		purged, err := db.PurgeChirps(cfg.trashRetention)
+		if err != nil {
+			log.Printf("Couldn't purge trash: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d chirps from the trash", purged)
+		}
+	}
+}
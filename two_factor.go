@@ -0,0 +1,272 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/totp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// twoFactorChallengeSeconds is how long a user has to type their code after the password
+	twoFactorChallengeSeconds = 5 * 60
+	recoveryCodeCount         = 10
+)
+
+// respondWithTwoFactorChallenge answers a correct password of a user with two-factor authentication
+// with a short-lived token to exchange, together with a code, at /api/login/2fa
+func respondWithTwoFactorChallenge(w http.ResponseWriter, user Database.User) {
+	type returnVals struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+
+	challengeToken, err := createToken(user.Id, "", 0, twoFactorChallengeSeconds, "chirpy-2fa")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating the challenge-JWT")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{TwoFactorRequired: true, ChallengeToken: challengeToken})
+}
+
+// generateRecoveryCodes returns readable one-time codes and the hashes that get stored
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := hex.EncodeToString(raw)
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code of user
+func checkSecondFactor(db *Database.DB, user Database.User, code, recoveryCode string) bool {
+	if recoveryCode != "" {
+		normalized := strings.ToLower(strings.TrimSpace(recoveryCode))
+		return db.UseRecoveryCode(user.Id, hashToken(normalized)) == nil
+	}
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	return db.UseTOTPCounter(user.Id, counter) == nil
+}
+
+func enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	user, err := db.GetUser(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	if user.TOTPEnabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate secret")
+		return
+	}
+	_, err = db.SetPendingTOTP(id, secret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start enrollment")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Secret: secret, ProvisioningURI: totp.ProvisioningURI("Chirpy", user.Email, secret)})
+}
+
+func (cfg *apiConfig) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type returnVals struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := db.GetUser(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		respondWithError(w, http.StatusConflict, "Start enrollment first")
+		return
+	}
+	// A stolen access token mustn't be able to guess codes, they are throttled like logins
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	counter, ok := totp.Validate(user.TOTPPendingSecret, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	cfg.passLogin(r, user.Email)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate recovery codes")
+		return
+	}
+	_, err = db.EnableTOTP(id, counter, hashes)
+	if errors.Is(err, Database.ErrTOTPNotPending) {
+		respondWithError(w, http.StatusConflict, "Start enrollment first")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+	// Recovery codes are only stored hashed, this is the only time they are shown
+	respondWithJSON(w, http.StatusOK, returnVals{RecoveryCodes: codes})
+}
+
+func (cfg *apiConfig) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := db.GetUser(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	if !user.TOTPEnabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled")
+		return
+	}
+	// A stolen access token mustn't be able to guess codes, they are throttled like logins
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	if !checkSecondFactor(db, user, params.Code, params.RecoveryCode) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	cfg.passLogin(r, user.Email)
+
+	_, err = db.DisableTOTP(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+	respondWithoutJSON(w, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) twoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	id, errorCode := verifyToken("chirpy-2fa", params.ChallengeToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	user, err := db.GetUser(id)
+	if err != nil || !user.TOTPEnabled {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	// Codes are only a million strong, they are throttled like passwords
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	if !checkSecondFactor(db, user, params.Code, params.RecoveryCode) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	cfg.completeLogin(r, user.Email)
+	respondWithLogin(w, r, user)
+}
@@ -2,13 +2,24 @@ package main
 
 import (
 	Database "chirpy/internal"
+	"chirpy/internal/passwords"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
+// validatePassword checks password against the configured policy for the account with email
+func (cfg *apiConfig) validatePassword(password, email string) []validationError {
+	var violations []validationError
+	for _, violation := range cfg.passwordPolicy.Check(password, email) {
+		violations = append(violations, validationError{Rule: violation.Rule, Message: violation.Message})
+	}
+	return violations
+}
+
 func addUserHandler(w http.ResponseWriter, r *http.Request) {
 	db, err := Database.NewDB("")
 	if err != nil {
@@ -24,6 +35,7 @@ func addUserHandler(w http.ResponseWriter, r *http.Request) {
 		Id          int    `json:"id"`
 		Email       string `json:"email"`
 		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Verified    bool   `json:"verified"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -34,58 +46,255 @@ func addUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	violations := validateEmail(params.Email)
+	violations = append(violations, ApiConfig.validatePassword(params.Password, params.Email)...)
+	if len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid user", violations)
+		return
+	}
+
 	var user Database.User
 	user, err = db.CreateUser(params.Email, params.Password)
+	if errors.Is(err, Database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email already taken")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, returnVals{Id: user.Id, Email: user.Email, IsChirpyRed: false})
+	// The user can ask for a new email if this one fails, so it doesn't fail the signup
+	if err := ApiConfig.sendVerificationEmail(db, user); err != nil {
+		log.Printf("Couldn't send verification email to user %d: %s", user.Id, err)
+	}
+	respondWithJSON(w, http.StatusCreated, returnVals{Id: user.Id, Email: user.Email, IsChirpyRed: false, Verified: user.Verified})
+}
+
+// userChanges are the fields of a user that a PUT or PATCH changes, nil fields are left as they are
+type userChanges struct {
+	Email           *string
+	CurrentPassword string
+	Password        *string
+	Profile         Database.ProfileUpdate
+}
+
+// validate checks every changed field of the user whose email is currentEmail
+func (changes userChanges) validate(currentEmail string) []validationError {
+	violations := validateProfile(changes.Profile)
+	if changes.Email != nil {
+		violations = append(violations, validateEmail(*changes.Email)...)
+	}
+	if changes.Password != nil {
+		email := currentEmail
+		if changes.Email != nil {
+			email = *changes.Email
+		}
+		violations = append(violations, ApiConfig.validatePassword(*changes.Password, email)...)
+	}
+	return violations
 }
 
 func modifyUserHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email           string  `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+		Password        string  `json:"password"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	changes := userChanges{
+		CurrentPassword: params.CurrentPassword,
+		Profile:         Database.ProfileUpdate{Handle: params.Handle, DisplayName: params.DisplayName, Bio: params.Bio, AvatarURL: params.AvatarURL},
+	}
+	if params.Email != "" {
+		changes.Email = &params.Email
+	}
+	// An empty password keeps the current one instead of being hashed as the new password
+	if params.Password != "" {
+		changes.Password = &params.Password
+	}
+	applyUserChanges(w, r, changes)
+}
+
+// patchUserHandler applies a JSON Merge Patch (RFC 7396) to the user: only the fields in the
+// body change, and null clears the profile fields that can be empty
+func patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	if contentType != "" && contentType != "application/merge-patch+json" && contentType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Use application/merge-patch+json")
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil || patch == nil {
+		respondWithError(w, http.StatusBadRequest, "Body must be a JSON object")
+		return
+	}
+
+	changes := userChanges{}
+	var violations []validationError
+	// field reads one string member of the patch, null becomes an empty string where allowed
+	field := func(name string, clearable bool) (value *string) {
+		raw := patch[name]
+		if string(raw) == "null" {
+			if !clearable {
+				violations = append(violations, validationError{Rule: name, Message: name + " can't be removed"})
+				return nil
+			}
+			empty := ""
+			return &empty
+		}
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			violations = append(violations, validationError{Rule: name, Message: name + " must be a string"})
+			return nil
+		}
+		return &str
+	}
+	for name := range patch {
+		switch name {
+		case "email":
+			changes.Email = field(name, false)
+		case "password":
+			changes.Password = field(name, false)
+		case "current_password":
+			if value := field(name, false); value != nil {
+				changes.CurrentPassword = *value
+			}
+		case "handle":
+			changes.Profile.Handle = field(name, false)
+		case "display_name":
+			changes.Profile.DisplayName = field(name, true)
+		case "bio":
+			changes.Profile.Bio = field(name, true)
+		case "avatar_url":
+			changes.Profile.AvatarURL = field(name, true)
+		case "id", "is_chirpy_red", "verified", "pending_email":
+			violations = append(violations, validationError{Rule: name, Message: name + " is read-only"})
+		default:
+			violations = append(violations, validationError{Rule: name, Message: "Unknown field " + name})
+		}
+	}
+	if len(violations) > 0 {
+		sort.Slice(violations, func(i, j int) bool { return violations[i].Rule < violations[j].Rule })
+		respondWithValidationErrors(w, "Invalid user", violations)
+		return
+	}
+	applyUserChanges(w, r, changes)
+}
+
+// applyUserChanges validates and saves changes to the user of the access token. Fields that
+// aren't changed, premium status included, keep their value
+func applyUserChanges(w http.ResponseWriter, r *http.Request, changes userChanges) {
 	db, err := Database.NewDB("")
-	var user Database.User
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
 		return
 	}
 
-	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
 	type returnVals struct {
 		Id          int    `json:"id"`
 		Email       string `json:"email"`
 		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarURL   string `json:"avatar_url"`
+		// PendingEmail is set while a changed email waits for confirmation
+		PendingEmail string `json:"pending_email,omitempty"`
 	}
 
 	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	id, errorCode := verifyToken("chirpy-access", stringToken)
+	if id == -1 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	user, err := db.GetUser(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if violations := changes.validate(user.Email); len(violations) > 0 {
+		respondWithValidationErrors(w, "Invalid user", violations)
 		return
 	}
+	// A stolen access token isn't enough to take over the account, changing the email or the
+	// password asks for the current password
+	emailChange := changes.Email != nil && *changes.Email != user.Email
+	if emailChange || changes.Password != nil {
+		if !ApiConfig.checkLoginThrottle(w, r, user.Email) {
+			return
+		}
+		ok, err := passwords.Verify(user.Password, changes.CurrentPassword)
+		if err != nil || !ok {
+			respondWithError(w, http.StatusUnauthorized, "Current password is required to change the email or password")
+			return
+		}
+		ApiConfig.passLogin(r, user.Email)
+	}
 
-	id, errorCode := verifyToken("chirpy-access", stringToken)
-	if id == -1 {
-		respondWithError(w, errorCode, "Unauthorized")
+	// Every field is saved at once, so a taken email or handle leaves the account untouched
+	update := Database.AccountUpdate{Password: changes.Password, Profile: changes.Profile}
+	// A new email only replaces the current one once it is confirmed from the new inbox
+	if emailChange {
+		update.PendingEmail = changes.Email
+	}
+	user, err = db.UpdateAccount(id, update)
+	if errors.Is(err, Database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email already taken")
+		return
+	}
+	if errors.Is(err, Database.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, "Handle already taken")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating user")
 		return
-	} else {
-		user, err = db.UpdateUser(id, params.Email, &params.Password, false)
+	}
+	if emailChange {
+		err = ApiConfig.sendEmailChange(user, *changes.Email)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send confirmation email")
+			return
+		}
+	}
+	// Whoever else knew the old password is logged out, this device included
+	if changes.Password != nil {
+		err = db.RevokeUserTokens(id)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Error updating user")
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions")
 			return
 		}
 	}
-	respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Email: user.Email, IsChirpyRed: false})
+	respondWithJSON(w, http.StatusOK, returnVals{
+		Id:          user.Id,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+
+		PendingEmail: user.PendingEmail,
+	})
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 	db, err := Database.NewDB("")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
@@ -97,6 +306,56 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		Password         string `json:"password"`
 		ExpiresInSeconds *int   `json:"expires_in_seconds"`
 	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	if !cfg.checkLoginThrottle(w, r, params.Email) {
+		return
+	}
+
+	user, err := db.GetUserByEmail(params.Email)
+	if errors.Is(err, Database.ErrUserNotFound) {
+		passwords.Verify(cfg.dummyPasswordHash, params.Password)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+
+	ok, err := passwords.Verify(user.Password, params.Password)
+	if err != nil {
+		log.Printf("Couldn't verify password of user %d: %s", user.Id, err)
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	// Hashes made with an older algorithm or parameters are upgraded while the password is at hand
+	if !Database.PasswordHasher.Current(user.Password) {
+		if err := db.RehashPassword(user.Id, params.Password); err != nil {
+			log.Printf("Couldn't rehash password of user %d: %s", user.Id, err)
+		}
+	}
+	// The code of the second step is throttled too, until then only this attempt is given back
+	if user.TOTPEnabled {
+		cfg.passLogin(r, user.Email)
+		respondWithTwoFactorChallenge(w, user)
+		return
+	}
+	cfg.completeLogin(r, user.Email)
+	respondWithLogin(w, r, user)
+}
+
+// respondWithLogin starts a session for a user who proved who they are and issues its tokens
+func respondWithLogin(w http.ResponseWriter, r *http.Request, user Database.User) {
 	type returnVals struct {
 		Id           int    `json:"id"`
 		Email        string `json:"email"`
@@ -105,40 +364,28 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		IsChirpyRed  bool   `json:"is_chirpy_red"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	db, err := Database.NewDB("")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+	session, err := db.CreateSession(user.Id, userAgent(r), clientIP(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start session")
 		return
 	}
 
-	users, err := db.GetUsers()
+	accessToken, err := createToken(user.Id, user.Role, session.Id, accessTokenSeconds, "chirpy-access")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve users")
+		respondWithError(w, http.StatusInternalServerError, "Error creating the access-JWT")
 		return
 	}
-	for _, user := range users {
-		if user.Email == params.Email {
-			err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password))
-			if err != nil {
-				respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-				return
-			} else {
-				accessToken, err := createToken(user.Id, 60*60, "chirpy-access")
-				if err != nil {
-					respondWithError(w, http.StatusInternalServerError, "Error creating the access-JWT")
-					return
-				}
-				refreshToken, err := createToken(user.Id, 60*60*24*60, "chirpy-refresh")
-				if err != nil {
-					respondWithError(w, http.StatusInternalServerError, "Error creating the refresh-JWT")
-					return
-				}
-				respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Email: user.Email, Token: accessToken, RefreshToken: refreshToken, IsChirpyRed: user.IsChirpyRed})
-			}
-		}
+	refreshToken, err := createRefreshToken(session)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating the refresh-JWT")
+		return
 	}
+	respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Email: user.Email, Token: accessToken, RefreshToken: refreshToken, IsChirpyRed: user.IsChirpyRed})
 }
 
 func webhookHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,112 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/mailer"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const verificationExpirySeconds = 60 * 60 * 24
+
+// validateEmail checks that email is a bare address like "name@example.com"
+func validateEmail(email string) []validationError {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return []validationError{{Rule: "email", Message: "Email must be a valid address"}}
+	}
+	return nil
+}
+
+// sendVerificationEmail mails user a signed link that verifies their current email
+func (cfg *apiConfig) sendVerificationEmail(db *Database.DB, user Database.User) error {
+	token, err := createEmailToken(user.Id, user.Email, verificationExpirySeconds, "chirpy-verify")
+	if err != nil {
+		return err
+	}
+	link := cfg.publicURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	err = cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nOpen this link within 24 hours to verify your email:\n%s", link),
+	})
+	if err != nil {
+		return err
+	}
+	return db.SetVerificationSent(user.Id, time.Now())
+}
+
+func verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	type returnVals struct {
+		Id       int    `json:"id"`
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+	}
+
+	id, email, err := verifyEmailToken("chirpy-verify", r.URL.Query().Get("token"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link")
+		return
+	}
+
+	user, err := db.VerifyUser(id, email)
+	if errors.Is(err, Database.ErrEmailChanged) || errors.Is(err, Database.ErrUserNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnVals{Id: user.Id, Email: user.Email, Verified: user.Verified})
+}
+
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := Database.NewDB("")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open database")
+		return
+	}
+
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+
+	user, err := db.GetUser(userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+	if user.Verified {
+		respondWithError(w, http.StatusConflict, "Email already verified")
+		return
+	}
+	if wait := cfg.verificationResendInterval - time.Since(user.VerificationSentAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Verification email sent recently, try again later")
+		return
+	}
+
+	err = cfg.sendVerificationEmail(db, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+	respondWithoutJSON(w, http.StatusAccepted)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	Database "chirpy/internal"
+	"chirpy/internal/events"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+	wsSendBuffer     = 64
+
+	wsCloseTokenExpired = 4001
+
+	// wsRelationsTTL is how long the blocks, mutes and follows of a client are cached, changes
+	// reach open connections within that time
+	wsRelationsTTL = 30 * time.Second
+)
+
+const (
+	channelTimeline      = "timeline"
+	channelNotifications = "notifications"
+	channelThreadPrefix  = "thread:"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// CORS is open to every origin, the socket is authenticated with the access token instead
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsMessage is what clients send: subscribe and unsubscribe to a channel, or auth with a
+// fresh access token to keep the connection open past the expiry of the first one
+type wsMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Token   string `json:"token"`
+}
+
+// wsReply is what the server sends back: acks, errors and events of subscribed channels
+type wsReply struct {
+	Type    string        `json:"type"`
+	Channel string        `json:"channel,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Event   *events.Event `json:"event,omitempty"`
+}
+
+type wsClient struct {
+	userId        int
+	conn          *websocket.Conn
+	send          chan wsReply
+	mux           *sync.Mutex
+	subscriptions map[string]bool
+	expiry        chan time.Time
+	// token is the access token the client last authenticated with, guarded by mux
+	token string
+	// relations is only used by the write loop, see loadRelations
+	relations wsRelations
+}
+
+// wsRelations are the authors a client doesn't see or follows, so events can be filtered
+// without loading the database for each of them
+type wsRelations struct {
+	excluded  map[int]bool
+	muted     map[int]bool
+	following map[int]bool
+	loadedAt  time.Time
+}
+
+// wsHandler upgrades to a WebSocket authenticated with the access token in the
+// Authorization header or, for browsers, the token query parameter
+func (cfg *apiConfig) wsHandler(w http.ResponseWriter, r *http.Request) {
+	stringToken := strings.TrimPrefix(r.Header.Get("authorization"), "Bearer ")
+	if stringToken == "" {
+		stringToken = r.URL.Query().Get("token")
+	}
+	userId, errorCode := verifyToken("chirpy-access", stringToken)
+	if errorCode != 0 {
+		respondWithError(w, errorCode, "Unauthorized")
+		return
+	}
+	expiresAt, err := tokenExpiry(stringToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Couldn't upgrade to websocket: %s", err)
+		return
+	}
+
+	client := &wsClient{
+		userId:        userId,
+		conn:          conn,
+		send:          make(chan wsReply, wsSendBuffer),
+		mux:           &sync.Mutex{},
+		subscriptions: make(map[string]bool),
+		expiry:        make(chan time.Time, 1),
+		token:         stringToken,
+	}
+	subscription, _, unsubscribe := cfg.events.Subscribe(0)
+	done := make(chan struct{})
+	go client.readLoop(done)
+	client.writeLoop(subscription, expiresAt, done)
+	unsubscribe()
+	conn.Close()
+}
+
+// readLoop handles the messages of the client until the connection fails, then closes done
+func (c *wsClient) readLoop(done chan struct{}) {
+	defer close(done)
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var message wsMessage
+		if err := c.conn.ReadJSON(&message); err != nil {
+			return
+		}
+		switch message.Type {
+		case "subscribe", "unsubscribe":
+			if !validChannel(message.Channel) {
+				c.reply(wsReply{Type: "error", Channel: message.Channel, Error: "Unknown channel"})
+				continue
+			}
+			c.mux.Lock()
+			c.subscriptions[message.Channel] = message.Type == "subscribe"
+			c.mux.Unlock()
+			c.reply(wsReply{Type: message.Type + "d", Channel: message.Channel})
+		case "auth":
+			userId, errorCode := verifyToken("chirpy-access", message.Token)
+			expiresAt, err := tokenExpiry(message.Token)
+			if errorCode != 0 || err != nil || userId != c.userId {
+				c.reply(wsReply{Type: "error", Error: "Invalid token"})
+				continue
+			}
+			c.mux.Lock()
+			c.token = message.Token
+			c.mux.Unlock()
+			select {
+			case c.expiry <- expiresAt:
+			default:
+			}
+			c.reply(wsReply{Type: "authenticated"})
+		default:
+			c.reply(wsReply{Type: "error", Error: "Unknown message type"})
+		}
+	}
+}
+
+// reply queues a message for the client, a client too slow to drain its queue is dropped
+func (c *wsClient) reply(message wsReply) {
+	select {
+	case c.send <- message:
+	default:
+		c.conn.Close()
+	}
+}
+
+// writeLoop is the only writer of the connection: it forwards replies and matching bus
+// events, pings the client and closes the connection when the token expires or is revoked,
+// when the client falls behind the bus or when the read loop is done
+func (c *wsClient) writeLoop(subscription <-chan events.Event, expiresAt time.Time, done chan struct{}) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	expired := time.NewTimer(time.Until(expiresAt))
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case message := <-c.send:
+			if c.write(message) != nil {
+				return
+			}
+		case event, ok := <-subscription:
+			if !ok {
+				c.close(websocket.CloseTryAgainLater, "Too slow to keep up")
+				return
+			}
+			for _, channel := range c.channelsFor(event) {
+				if c.write(wsReply{Type: "event", Channel: channel, Event: &event}) != nil {
+					return
+				}
+			}
+		case expiresAt := <-c.expiry:
+			expired.Reset(time.Until(expiresAt))
+		case <-expired.C:
+			c.close(wsCloseTokenExpired, "Token expired")
+			return
+		case <-ping.C:
+			// A logout or password change revokes the token, the connection ends with it
+			c.mux.Lock()
+			token := c.token
+			c.mux.Unlock()
+			if _, errorCode := verifyToken("chirpy-access", token); errorCode == http.StatusUnauthorized {
+				c.close(wsCloseTokenExpired, "Token revoked")
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if c.conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) write(message wsReply) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(message)
+}
+
+func (c *wsClient) close(code int, reason string) {
+	deadline := time.Now().Add(wsWriteWait)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
+// channelsFor returns the subscribed channels an event belongs to
+func (c *wsClient) channelsFor(event events.Event) []string {
+	c.mux.Lock()
+	subscriptions := make(map[string]bool, len(c.subscriptions))
+	for channel, subscribed := range c.subscriptions {
+		subscriptions[channel] = subscribed
+	}
+	c.mux.Unlock()
+
+	var channels []string
+	if !event.IsChirpEvent() {
+		if subscriptions[channelNotifications] && event.UserId == c.userId {
+			channels = append(channels, channelNotifications)
+		}
+		return channels
+	}
+
+	thread := channelThreadPrefix + strconv.Itoa(event.ReplyToId)
+	timeline := subscriptions[channelTimeline]
+	if !timeline && (event.ReplyToId == 0 || !subscriptions[thread]) {
+		return channels
+	}
+	if !c.canSee(event) {
+		return channels
+	}
+	if timeline && c.onTimeline(event) {
+		channels = append(channels, channelTimeline)
+	}
+	if event.ReplyToId != 0 && subscriptions[thread] {
+		channels = append(channels, thread)
+	}
+	return channels
+}
+
+// loadRelations returns the cached relations of the client, they are reloaded once older
+// than wsRelationsTTL
+func (c *wsClient) loadRelations() (wsRelations, error) {
+	if !c.relations.loadedAt.IsZero() && time.Since(c.relations.loadedAt) < wsRelationsTTL {
+		return c.relations, nil
+	}
+	db, err := Database.NewDB("")
+	if err != nil {
+		return wsRelations{}, err
+	}
+	excluded, err := db.GetExcludedAuthors(c.userId, false)
+	if err != nil {
+		return wsRelations{}, err
+	}
+	muted, err := db.GetExcludedAuthors(c.userId, true)
+	if err != nil {
+		return wsRelations{}, err
+	}
+	following, err := db.GetFollowing(c.userId)
+	if err != nil {
+		return wsRelations{}, err
+	}
+	relations := wsRelations{excluded: excluded, muted: muted, following: make(map[int]bool), loadedAt: time.Now()}
+	for _, follow := range following {
+		relations.following[follow.FolloweeId] = true
+	}
+	c.relations = relations
+	return relations, nil
+}
+
+// canSee checks the chirp of an event against its visibility and the blocks of the client
+func (c *wsClient) canSee(event events.Event) bool {
+	relations, err := c.loadRelations()
+	if err != nil || relations.excluded[event.AuthorId] {
+		return false
+	}
+	if event.Type == events.ChirpDeleted {
+		return event.Visibility == "" || event.Visibility == Database.VisibilityPublic || event.AuthorId == c.userId
+	}
+	db, err := Database.NewDB("")
+	if err != nil {
+		return false
+	}
+	_, err = db.GetChirp(c.userId, event.ChirpId)
+	return err == nil
+}
+
+// onTimeline reports whether an event is from the client or an account they follow and haven't muted
+func (c *wsClient) onTimeline(event events.Event) bool {
+	if event.AuthorId == c.userId {
+		return true
+	}
+	relations, err := c.loadRelations()
+	if err != nil || relations.muted[event.AuthorId] {
+		return false
+	}
+	return relations.following[event.AuthorId]
+}
+
+func validChannel(channel string) bool {
+	if channel == channelTimeline || channel == channelNotifications {
+		return true
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(channel, channelThreadPrefix))
+	return strings.HasPrefix(channel, channelThreadPrefix) && err == nil && id > 0
+}